@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"unicode/utf8"
+)
+
+// matches the size of the arguments column of audit_log
+const AuditArgumentsMax = 1000
+
+type AuditEntry struct {
+	ActorID   string
+	Action    string
+	Arguments string
+	Timestamp int64
+}
+
+// records a change made by actorID in roomID, timestamp is in milliseconds
+func (kBot *KarmaBot) Audit(ctx context.Context, roomID, actorID, action, arguments string, timestamp int64) {
+	if utf8.RuneCountInString(arguments) > AuditArgumentsMax {
+		arguments = string([]rune(arguments)[:AuditArgumentsMax])
+	}
+	query := `INSERT INTO audit_log (roomID, actorID, action, arguments, origin_server_ts) VALUES (?, ?, ?, ?, ?)`
+	_, err := kBot.sqlDB.DB.ExecContext(ctx, query, roomID, actorID, action, arguments, timestamp)
+	if err != nil {
+		kBot.logger.Warnf("Error in Audit for (%s, %s, %s, %q): %v", roomID, actorID, action, arguments, err)
+	}
+}
+
+// most recent entries of roomID, newest first
+func (kBot *KarmaBot) GetAuditLog(ctx context.Context, roomID string, limit int) []AuditEntry {
+	entries := []AuditEntry{}
+	query := `SELECT actorID, action, arguments, origin_server_ts FROM audit_log WHERE roomID = ? ORDER BY origin_server_ts DESC LIMIT ?`
+	rows, err := kBot.sqlDB.DB.QueryContext(ctx, query, roomID, limit)
+	if err != nil {
+		kBot.logger.Warnf("Error in GetAuditLog for room %q: %v", roomID, err)
+		return entries
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry AuditEntry
+		err = rows.Scan(&entry.ActorID, &entry.Action, &entry.Arguments, &entry.Timestamp)
+		if err != nil {
+			kBot.logger.Warnf("Error while scanning audit log of room %q: %v", roomID, err)
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
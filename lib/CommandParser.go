@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type KarmaArg struct {
+	Kind   KarmaArgKind
+	Raw    string
+	UserID string // ArgUser
+	HREF   string // ArgUser, pill or user ID to show in replies
+	Room   string // ArgRoom, room alias or ID
+	Int    int64  // ArgInteger
+	Window KarmaWindow
+	Text   string // ArgWord, ArgString
+}
+
+type KarmaArgs struct {
+	Command  string
+	Prefix   string
+	SenderID string
+	Args     []KarmaArg
+}
+
+var anchorRegex = regexp.MustCompile(`(?is)<a\s+[^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+var tagRegex = regexp.MustCompile(`(?s)<[^>]*>`)
+var tokenRegex = regexp.MustCompile(`"([^"]*)"|“([^”]*)”|(\S+)`)
+
+// a server name ends with a letter or digit or is a bracketed IPv6 literal,
+// so punctuation following an ID is not taken as part of it
+const serverNameRegexString = `(?:[A-Za-z0-9](?:[A-Za-z0-9.-]*[A-Za-z0-9])?|\[[0-9A-Fa-f:.]+\])(?::[0-9]+)?`
+
+var userIDRegex = regexp.MustCompile(`^(@[^:\s]+:` + serverNameRegexString + `)[.,:;!?]*$`)
+var roomAliasRegex = regexp.MustCompile(`^([#!][^:\s]+:` + serverNameRegexString + `)[.,:;!?]*$`)
+var integerRegex = regexp.MustCompile(`^[+-]?[0-9]+$`)
+
+func commandRegex(prefix string) *regexp.Regexp {
+	return regexp.MustCompile(`(?is)^\s*` + regexp.QuoteMeta(prefix) + `([a-z][a-z0-9_-]*)(\s+.*)?$`)
+}
+
+// splits a command message into its name and typed arguments, bodyHTML is
+// preferred over body when present since it carries the user pills
+func ParseCommand(senderID, prefix, body, bodyHTML string) (*KarmaArgs, bool) {
+	cmdRegex := commandRegex(prefix)
+	groups := cmdRegex.FindStringSubmatch(strings.TrimSpace(body))
+	if groups == nil {
+		return nil, false
+	}
+	args := &KarmaArgs{
+		Command:  strings.ToLower(groups[1]),
+		Prefix:   prefix,
+		SenderID: senderID,
+		Args:     []KarmaArg{},
+	}
+	if bodyHTML == "" {
+		args.Args = tokenizeText(groups[2], false)
+		return args, true
+	}
+	hgroups := cmdRegex.FindStringSubmatch(strings.TrimSpace(bodyHTML))
+	if hgroups == nil {
+		args.Args = tokenizeText(groups[2], false)
+		return args, true
+	}
+	rest := hgroups[2]
+	last := 0
+	for _, loc := range anchorRegex.FindAllStringSubmatchIndex(rest, -1) {
+		args.Args = append(args.Args, tokenizeText(rest[last:loc[0]], true)...)
+		href := html.UnescapeString(rest[loc[2]:loc[3]])
+		text := html.UnescapeString(tagRegex.ReplaceAllString(rest[loc[4]:loc[5]], ""))
+		arg := classifyURI(href)
+		if arg.Kind == ArgUser {
+			arg.HREF = rest[loc[0]:loc[1]]
+		} else if arg.Kind == ArgWord {
+			arg = classifyToken(text)
+		}
+		arg.Raw = rest[loc[0]:loc[1]]
+		args.Args = append(args.Args, arg)
+		last = loc[1]
+	}
+	args.Args = append(args.Args, tokenizeText(rest[last:], true)...)
+	return args, true
+}
+
+func tokenizeText(text string, isHTML bool) []KarmaArg {
+	if isHTML {
+		text = html.UnescapeString(tagRegex.ReplaceAllString(text, " "))
+	}
+	tokens := []KarmaArg{}
+	for _, groups := range tokenRegex.FindAllStringSubmatch(text, -1) {
+		if groups[3] == "" {
+			quoted := groups[1] + groups[2]
+			tokens = append(tokens, KarmaArg{Kind: ArgString, Raw: groups[0], Text: quoted})
+		} else {
+			tokens = append(tokens, classifyToken(groups[3]))
+		}
+	}
+	return tokens
+}
+
+func classifyToken(token string) KarmaArg {
+	if groups := userIDRegex.FindStringSubmatch(token); groups != nil {
+		return KarmaArg{Kind: ArgUser, Raw: token, UserID: groups[1], HREF: groups[1]}
+	}
+	if groups := roomAliasRegex.FindStringSubmatch(token); groups != nil {
+		return KarmaArg{Kind: ArgRoom, Raw: token, Room: groups[1]}
+	}
+	if integerRegex.MatchString(token) {
+		n, err := strconv.ParseInt(token, 10, 64)
+		if err == nil {
+			return KarmaArg{Kind: ArgInteger, Raw: token, Int: n}
+		}
+	}
+	if window, ok := ParseKarmaWindow(token, time.Now()); ok {
+		return KarmaArg{Kind: ArgWindow, Raw: token, Window: window}
+	}
+	if arg := classifyURI(token); arg.Kind != ArgWord {
+		return arg
+	}
+	return KarmaArg{Kind: ArgWord, Raw: token, Text: token}
+}
+
+// understands https://matrix.to/#/... links and matrix: URIs
+func classifyURI(uri string) KarmaArg {
+	ident := ""
+	if strings.HasPrefix(uri, "https://matrix.to/#/") {
+		ident = strings.TrimPrefix(uri, "https://matrix.to/#/")
+	} else if strings.HasPrefix(uri, "matrix:u/") {
+		ident = "@" + strings.TrimPrefix(uri, "matrix:u/")
+	} else if strings.HasPrefix(uri, "matrix:r/") {
+		ident = "#" + strings.TrimPrefix(uri, "matrix:r/")
+	} else if strings.HasPrefix(uri, "matrix:roomid/") {
+		ident = "!" + strings.TrimPrefix(uri, "matrix:roomid/")
+	}
+	ident = strings.SplitN(strings.SplitN(ident, "?", 2)[0], "/", 2)[0]
+	if unescaped, err := url.PathUnescape(ident); err == nil {
+		ident = unescaped
+	}
+	if groups := userIDRegex.FindStringSubmatch(ident); groups != nil {
+		return KarmaArg{Kind: ArgUser, Raw: uri, UserID: groups[1], HREF: groups[1]}
+	}
+	if groups := roomAliasRegex.FindStringSubmatch(ident); groups != nil {
+		return KarmaArg{Kind: ArgRoom, Raw: uri, Room: groups[1]}
+	}
+	return KarmaArg{Kind: ArgWord, Raw: uri, Text: uri}
+}
+
+// the argument as plain text, without the markup of pills
+func (arg *KarmaArg) Plain() string {
+	switch arg.Kind {
+	case ArgWord, ArgString:
+		return arg.Text
+	case ArgUser:
+		return arg.UserID
+	case ArgRoom:
+		return arg.Room
+	}
+	return arg.Raw
+}
+
+func (args *KarmaArgs) OfKind(kind KarmaArgKind) []KarmaArg {
+	found := []KarmaArg{}
+	for _, arg := range args.Args {
+		if arg.Kind == kind {
+			found = append(found, arg)
+		}
+	}
+	return found
+}
+
+// first mentioned user, defaults to the sender
+func (args *KarmaArgs) Target() (string, string) {
+	for _, arg := range args.Args {
+		if arg.Kind == ArgUser {
+			return arg.UserID, arg.HREF
+		}
+	}
+	return args.SenderID, args.SenderID
+}
+
+// first integer argument, def if there is none
+func (args *KarmaArgs) Int(def int64) int64 {
+	for _, arg := range args.Args {
+		if arg.Kind == ArgInteger {
+			return arg.Int
+		}
+	}
+	return def
+}
+
+// first window argument, all time if there is none
+func (args *KarmaArgs) Window() KarmaWindow {
+	for _, arg := range args.Args {
+		if arg.Kind == ArgWindow {
+			return arg.Window
+		}
+	}
+	return KarmaWindow{0, ""}
+}
+
+// words and quoted strings in order
+func (args *KarmaArgs) Words() []string {
+	words := []string{}
+	for _, arg := range args.Args {
+		if arg.Kind == ArgWord || arg.Kind == ArgString {
+			words = append(words, arg.Text)
+		}
+	}
+	return words
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	sender := "@banana-bot:matrix.org"
+
+	////// t1
+	args, ok := ParseCommand(sender, "!", "!Karma", "")
+	if !ok || args.Command != "karma" || len(args.Args) != 0 {
+		t.Fatalf("t1.1 failure: %v", args)
+	}
+	if userID, href := args.Target(); userID != sender || href != sender {
+		t.Errorf("t1.2 failure: %q %q", userID, href)
+	}
+
+	////// t2
+	pill := `<a href="https://matrix.to/#/@jane-doe:matrix.org">Jane Doe</a>`
+	args, ok = ParseCommand(sender, "!", "!whogave Jane Doe 5 7d", "!whogave "+pill+" 5 7d")
+	if !ok || len(args.Args) != 3 {
+		t.Fatalf("t2.1 failure: %v", args)
+	}
+	if userID, href := args.Target(); userID != "@jane-doe:matrix.org" || href != pill {
+		t.Errorf("t2.2 failure: %q %q", userID, href)
+	}
+	if args.Int(10) != 5 || args.Window().Desc != "in the last 7d" {
+		t.Errorf("t2.3 failure: %v", args)
+	}
+
+	////// t3
+	args, _ = ParseCommand(sender, "!", `!adjust @john-doe:matrix.org +3 "fixed the build" matrix:u/jane-doe:matrix.org #room:matrix.org`, "")
+	kinds := []KarmaArgKind{ArgUser, ArgInteger, ArgString, ArgUser, ArgRoom}
+	if len(args.Args) != len(kinds) {
+		t.Fatalf("t3.1 failure: %v", args)
+	}
+	for i, kind := range kinds {
+		if args.Args[i].Kind != kind {
+			t.Errorf("t3.2 failure: argument %d is %v", i, args.Args[i])
+		}
+	}
+	if args.Args[1].Int != 3 || args.Args[2].Text != "fixed the build" || args.Args[3].UserID != "@jane-doe:matrix.org" {
+		t.Errorf("t3.3 failure: %v", args)
+	}
+	users := args.OfKind(ArgUser)
+	if len(users) != 2 || users[0].UserID != "@john-doe:matrix.org" {
+		t.Errorf("t3.4 failure: %v", users)
+	}
+
+	////// t4
+	args, _ = ParseCommand(sender, "!", "!karma alice", `!karma <a href="https://matrix.to/#/%40alice%3Aexample.org">alice</a> <b>since:2026-01-01</b>`)
+	if userID, _ := args.Target(); userID != "@alice:example.org" {
+		t.Errorf("t4.1 failure: %q", userID)
+	}
+	if args.Window().Desc != "since 2026-01-01" {
+		t.Errorf("t4.2 failure: %v", args)
+	}
+
+	////// t5
+	if _, ok := ParseCommand(sender, "!", "hello !karma", ""); ok {
+		t.Errorf("t5 failure")
+	}
+
+	////// t6
+	args, ok = ParseCommand(sender, "?!", "?!top 5", "")
+	if !ok || args.Command != "top" || args.Prefix != "?!" || args.Int(10) != 5 {
+		t.Errorf("t6.1 failure: %v", args)
+	}
+	if _, ok := ParseCommand(sender, "?!", "!top 5", ""); ok {
+		t.Errorf("t6.2 failure")
+	}
+
+	////// t7
+	args, _ = ParseCommand(sender, "!", "!karma @alice:example.org?", "")
+	if userID, _ := args.Target(); userID != "@alice:example.org" {
+		t.Errorf("t7.1 failure: %q", userID)
+	}
+	args, _ = ParseCommand(sender, "!", "!karma @alice:[::1]:8448, #room:example.org.", "")
+	if userID, _ := args.Target(); userID != "@alice:[::1]:8448" {
+		t.Errorf("t7.2 failure: %q", userID)
+	}
+	if rooms := args.OfKind(ArgRoom); len(rooms) != 1 || rooms[0].Room != "#room:example.org" {
+		t.Errorf("t7.3 failure: %v", rooms)
+	}
+}
+
+func TestAdjustArgs(t *testing.T) {
+	sender := "@banana-bot:matrix.org"
+
+	args, _ := ParseCommand(sender, "!", `!adjust @jane-doe:matrix.org +3 for fixing 2 "flaky" tests`, "")
+	targetID, _, amount, reason, ok := AdjustArgs(args)
+	if !ok || targetID != "@jane-doe:matrix.org" || amount != 3 || reason != "for fixing 2 flaky tests" {
+		t.Errorf("t1 failure: %q %d %q", targetID, amount, reason)
+	}
+
+	args, _ = ParseCommand(sender, "!", "!adjust @jane-doe:matrix.org -2", "")
+	if _, _, amount, reason, ok = AdjustArgs(args); !ok || amount != -2 || reason != "" {
+		t.Errorf("t2 failure: %d %q", amount, reason)
+	}
+
+	for i, body := range []string{"!adjust @jane-doe:matrix.org", "!adjust 5 @jane-doe:matrix.org", "!adjust @jane-doe:matrix.org 0"} {
+		args, _ = ParseCommand(sender, "!", body, "")
+		if _, _, _, _, ok = AdjustArgs(args); ok {
+			t.Errorf("t3.%d failure: %q", i+1, body)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+)
+
+type Command_Adjust struct {
+}
+
+func (u *Command_Adjust) Name() string {
+	return "adjust"
+}
+
+func (u *Command_Adjust) Aliases() []string {
+	return []string{}
+}
+
+func (u *Command_Adjust) Summary() string {
+	return "give or take karma from a user by hand"
+}
+
+func (u *Command_Adjust) Args() []KarmaArgSpec {
+	return []KarmaArgSpec{
+		{"user", ArgUser, false, "user whose karma is adjusted"},
+		{"N", ArgInteger, false, "karma to add, negative to take karma away"},
+		{"reason", ArgString, true, "why the karma was adjusted, shown by !why"},
+	}
+}
+
+func (u *Command_Adjust) NeedsTimer() bool {
+	return false
+}
+
+func (u *Command_Adjust) PowerLevel() int {
+	return PowerModerator
+}
+
+// relatesTo of the votes stored by !adjust, keeps them out of the stats of
+// the moderator, event IDs always start with "$"
+const AdjustRelatesTo = "adjust"
+
+// user, amount and the text after the amount as the reason
+func AdjustArgs(args *KarmaArgs) (string, string, int64, string, bool) {
+	targetID, targetHREF := "", ""
+	amount := int64(0)
+	reason := []string{}
+	found := false
+	for _, arg := range args.Args {
+		if found {
+			reason = append(reason, arg.Plain())
+		} else if arg.Kind == ArgUser && targetID == "" {
+			targetID, targetHREF = arg.UserID, arg.HREF
+		} else if arg.Kind == ArgInteger {
+			amount = arg.Int
+			found = true
+		}
+	}
+	if targetID == "" || amount == 0 {
+		return "", "", 0, "", false
+	}
+	text := strings.Join(strings.Fields(strings.Join(reason, " ")), " ")
+	if runes := []rune(text); len(runes) > ThankYouReasonMax {
+		text = string(runes[:ThankYouReasonMax])
+	}
+	return targetID, targetHREF, amount, text, true
+}
+
+func (u *Command_Adjust) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	roomID := evt.RoomID.String()
+	msg := ""
+	targetID, targetHREF, amount, reason, ok := AdjustArgs(args)
+	if !ok {
+		msg = fmt.Sprintf("Usage: `%s`", KarmaCommandUsage(args.Prefix, u))
+	} else if targetID == args.SenderID {
+		msg = "You can not adjust your own karma"
+	} else if kBot.IsOptOut(ctx, targetID) {
+		msg = "Unknown user"
+	} else {
+		kBot.KarmaAdd(ctx, args.SenderID, targetID, evt.ID.String(), roomID, AdjustRelatesTo, amount, evt.Timestamp, reason)
+		kBot.Audit(ctx, roomID, args.SenderID, "adjust", strings.TrimSpace(fmt.Sprintf("%s %+d %s", targetID, amount, reason)), evt.Timestamp)
+		kBot.logger.Infof("%s adjusted karma of %s by %+d in room %q", args.SenderID, targetID, amount, roomID)
+		msg = fmt.Sprintf("Adjusted karma of %s by %+d, it is now %d", targetHREF, amount, kBot.GetKarma(ctx, targetID, roomID, 0))
+	}
+	msgHTML := format.RenderMarkdown(msg, true, true)
+	kBot.mClient.SendMessageEvent(evt.RoomID, event.EventMessage, &msgHTML)
+	return true
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+)
+
+type Command_Audit struct {
+}
+
+func (u *Command_Audit) Name() string {
+	return "audit"
+}
+
+func (u *Command_Audit) Aliases() []string {
+	return []string{}
+}
+
+func (u *Command_Audit) Summary() string {
+	return "list the most recent changes made by moderators in this room"
+}
+
+func (u *Command_Audit) Args() []KarmaArgSpec {
+	return []KarmaArgSpec{
+		{"N", ArgInteger, true, "number of entries to list, defaults to 10"},
+	}
+}
+
+func (u *Command_Audit) NeedsTimer() bool {
+	return true
+}
+
+func (u *Command_Audit) PowerLevel() int {
+	return PowerModerator
+}
+
+func (u *Command_Audit) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	entries := kBot.GetAuditLog(ctx, evt.RoomID.String(), KarmaTopCount(args))
+	msg := AuditTable(entries)
+	msgHTML := format.RenderMarkdown(msg, true, true)
+	kBot.mClient.SendMessageEvent(evt.RoomID, event.EventMessage, &msgHTML)
+	return true
+}
+
+func AuditTable(entries []AuditEntry) string {
+	if len(entries) == 0 {
+		return "Nothing has been changed in this room yet"
+	}
+	var msg strings.Builder
+	msg.WriteString("| date | by | action | arguments |\n")
+	msg.WriteString("|------|----|--------|-----------|\n")
+	for _, entry := range entries {
+		date := time.UnixMilli(entry.Timestamp).UTC().Format("2006-01-02 15:04")
+		fmt.Fprintf(&msg, "| %s | %s | %s | %s |\n", date, entry.ActorID, entry.Action, EscapeMarkdown(entry.Arguments))
+	}
+	return msg.String()
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+)
+
+// matches the size of the value column of room_settings
+const RoomSettingMaxLength = 1000
+
+type Command_Config struct {
+}
+
+func (u *Command_Config) Name() string {
+	return "config"
+}
+
+func (u *Command_Config) Aliases() []string {
+	return []string{}
+}
+
+func (u *Command_Config) Summary() string {
+	return "show or change the settings of this room"
+}
+
+func (u *Command_Config) Args() []KarmaArgSpec {
+	return []KarmaArgSpec{
+		{"action", ArgWord, true, "get, set or reset, lists all settings when omitted"},
+		{"key", ArgWord, true, "setting to act on"},
+		{"value", ArgString, true, "new value for set"},
+	}
+}
+
+func (u *Command_Config) NeedsTimer() bool {
+	return true
+}
+
+func (u *Command_Config) PowerLevel() int {
+	return PowerModerator
+}
+
+// arguments as plain text, the value of set may span several of them
+func configWords(args *KarmaArgs) []string {
+	words := []string{}
+	for _, arg := range args.Args {
+		words = append(words, arg.Plain())
+	}
+	return words
+}
+
+func (u *Command_Config) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	roomID := evt.RoomID.String()
+	words := configWords(args)
+	usage := fmt.Sprintf("Usage: `%s`, see `%shelp config`", KarmaCommandUsage(args.Prefix, u), args.Prefix)
+	msg := ""
+	if len(words) == 0 {
+		msg = RoomSettingsTable(kBot, roomID)
+	} else if len(words) < 2 {
+		msg = usage
+	} else if setting, ok := FindRoomSetting(words[1]); !ok {
+		msg = fmt.Sprintf("Unknown setting %s, see `%sconfig` for the list of settings", EscapeMarkdown(words[1]), args.Prefix)
+	} else {
+		switch strings.ToLower(words[0]) {
+		case "get":
+			msg = RoomSettingLine(kBot, roomID, setting)
+		case "set":
+			if len(words) < 3 {
+				msg = usage
+				break
+			}
+			value, err := setting.Normalize(strings.Join(words[2:], " "))
+			if err != nil {
+				msg = fmt.Sprintf("Invalid value for %s: %s", setting.Name, EscapeMarkdown(err.Error()))
+				break
+			}
+			if utf8.RuneCountInString(value) > RoomSettingMaxLength {
+				msg = fmt.Sprintf("Invalid value for %s: longer than %d characters", setting.Name, RoomSettingMaxLength)
+				break
+			}
+			err = kBot.SetRoomSetting(roomID, setting.Name, value)
+			if err != nil {
+				kBot.logger.Warnf("Error while setting %s in room %q: %v", setting.Name, roomID, err)
+				msg = fmt.Sprintf("Could not change %s", setting.Name)
+				break
+			}
+			kBot.logger.Infof("%s set %s to %q in room %q", args.SenderID, setting.Name, value, roomID)
+			kBot.Audit(ctx, roomID, args.SenderID, "config set", setting.Name+" "+value, evt.Timestamp)
+			msg = RoomSettingLine(kBot, roomID, setting)
+		case "reset":
+			err := kBot.ResetRoomSetting(roomID, setting.Name)
+			if err != nil {
+				kBot.logger.Warnf("Error while resetting %s in room %q: %v", setting.Name, roomID, err)
+				msg = fmt.Sprintf("Could not reset %s", setting.Name)
+				break
+			}
+			kBot.logger.Infof("%s reset %s in room %q", args.SenderID, setting.Name, roomID)
+			kBot.Audit(ctx, roomID, args.SenderID, "config reset", setting.Name, evt.Timestamp)
+			msg = RoomSettingLine(kBot, roomID, setting)
+		default:
+			msg = usage
+		}
+	}
+	msgHTML := format.RenderMarkdown(msg, true, true)
+	kBot.mClient.SendMessageEvent(evt.RoomID, event.EventMessage, &msgHTML)
+	return true
+}
+
+func roomSettingValue(kBot *KarmaBot, roomID string, setting RoomSetting) (string, string) {
+	value, overridden := kBot.GetRoomSetting(roomID, setting.Name)
+	source := "default"
+	if overridden {
+		source = "room"
+	}
+	if value == "" {
+		return "none", source
+	}
+	return EscapeMarkdown(value), source
+}
+
+func RoomSettingLine(kBot *KarmaBot, roomID string, setting RoomSetting) string {
+	value, source := roomSettingValue(kBot, roomID, setting)
+	return fmt.Sprintf("%s = %s (%s)", setting.Name, value, source)
+}
+
+func RoomSettingsTable(kBot *KarmaBot, roomID string) string {
+	var msg strings.Builder
+	msg.WriteString("| setting | value | from | notes |\n")
+	msg.WriteString("|---------|-------|------|-------|\n")
+	for _, setting := range RoomSettings {
+		value, source := roomSettingValue(kBot, roomID, setting)
+		fmt.Fprintf(&msg, "| %s | %s | %s | %s |\n", setting.Name, value, source, setting.Help)
+	}
+	return msg.String()
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+
+	"maunium.net/go/mautrix/event"
+)
+
+type Command_Generous struct {
+}
+
+func (u *Command_Generous) Name() string {
+	return "generous"
+}
+
+func (u *Command_Generous) Aliases() []string {
+	return []string{}
+}
+
+func (u *Command_Generous) Summary() string {
+	return "list the users who gave the most karma in this room"
+}
+
+func (u *Command_Generous) Args() []KarmaArgSpec {
+	return argsCountWindow
+}
+
+func (u *Command_Generous) NeedsTimer() bool {
+	return true
+}
+
+func (u *Command_Generous) PowerLevel() int {
+	return PowerUser
+}
+
+func (u *Command_Generous) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	window := args.Window()
+	scores := kBot.GetKarmaGenerous(ctx, evt.RoomID.String(), window.Since, KarmaTopCount(args))
+	SendKarmaTable(evt, kBot, KarmaTableTitle("Most generous users in this room", window), scores)
+	return true
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+)
+
+type Command_Help struct {
+}
+
+func (u *Command_Help) Name() string {
+	return "help"
+}
+
+func (u *Command_Help) Aliases() []string {
+	return []string{"commands"}
+}
+
+func (u *Command_Help) Summary() string {
+	return "list the available commands or describe one of them"
+}
+
+func (u *Command_Help) Args() []KarmaArgSpec {
+	return []KarmaArgSpec{
+		{"command", ArgWord, true, "command to describe"},
+	}
+}
+
+func (u *Command_Help) NeedsTimer() bool {
+	return true
+}
+
+func (u *Command_Help) PowerLevel() int {
+	return PowerUser
+}
+
+func (u *Command_Help) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	words := args.Words()
+	msg := ""
+	if len(words) == 0 {
+		msg = KarmaHelp(args.Prefix)
+	} else {
+		name := strings.TrimPrefix(words[0], args.Prefix)
+		if command, ok := FindKarmaCommand(name); ok {
+			msg = KarmaCommandHelp(args.Prefix, command)
+		} else if suggestion := SuggestKarmaCommand(name); suggestion != "" {
+			msg = fmt.Sprintf("Unknown command `%s%s`, did you mean `%s%s`?", args.Prefix, name, args.Prefix, suggestion)
+		} else {
+			msg = fmt.Sprintf("Unknown command `%s%s`, see `%shelp` for the list of commands", args.Prefix, name, args.Prefix)
+		}
+	}
+	msgHTML := format.RenderMarkdown(msg, true, true)
+	kBot.mClient.SendMessageEvent(evt.RoomID, event.EventMessage, &msgHTML)
+	return true
+}
+
+func KarmaHelp(prefix string) string {
+	var msg strings.Builder
+	msg.WriteString("| command | notes |\n")
+	msg.WriteString("|---------|-------|\n")
+	for _, command := range KarmaCommands {
+		fmt.Fprintf(&msg, "| `%s` | %s |\n", KarmaCommandUsage(prefix, command), command.Summary())
+	}
+	fmt.Fprintf(&msg, "\nUse `%shelp <command>` for details about a command.", prefix)
+	return msg.String()
+}
+
+func KarmaCommandHelp(prefix string, command KarmaCommand) string {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "`%s`: %s\n", KarmaCommandUsage(prefix, command), command.Summary())
+	for _, arg := range command.Args() {
+		fmt.Fprintf(&msg, "\n- `%s`: %s", arg.Name, arg.Help)
+	}
+	if level := command.PowerLevel(); level > PowerUser {
+		fmt.Fprintf(&msg, "\n\nneeds power level %d", level)
+	}
+	if aliases := command.Aliases(); len(aliases) > 0 {
+		fmt.Fprintf(&msg, "\n\naliases: `%s%s`", prefix, strings.Join(aliases, "`, `"+prefix))
+	}
+	return msg.String()
+}
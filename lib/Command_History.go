@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix/event"
+)
+
+type Command_History struct {
+}
+
+type historyPeriod struct {
+	Name    string
+	Size    time.Duration
+	Buckets int
+	Layout  string
+}
+
+var historyPeriods = map[string]historyPeriod{
+	"day":    {"day", 24 * time.Hour, 14, "2006-01-02"},
+	"daily":  {"day", 24 * time.Hour, 14, "2006-01-02"},
+	"week":   {"week", 7 * 24 * time.Hour, 12, "2006-01-02"},
+	"weekly": {"week", 7 * 24 * time.Hour, 12, "2006-01-02"},
+}
+
+func (u *Command_History) Name() string {
+	return "history"
+}
+
+func (u *Command_History) Aliases() []string {
+	return []string{}
+}
+
+func (u *Command_History) Summary() string {
+	return "show the karma of a user over time"
+}
+
+func (u *Command_History) Args() []KarmaArgSpec {
+	return []KarmaArgSpec{
+		{"user", ArgUser, true, "user to look up, defaults to the sender"},
+		{"period", ArgWord, true, "bucket size, day (default) or week"},
+	}
+}
+
+func (u *Command_History) NeedsTimer() bool {
+	return true
+}
+
+func (u *Command_History) PowerLevel() int {
+	return PowerUser
+}
+
+func (u *Command_History) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	targetID, targetHREF := args.Target()
+	if kBot.IsOptOut(ctx, targetID) {
+		kBot.mClient.SendText(evt.RoomID, "Unknown user")
+		return true
+	}
+	period := historyPeriods["day"]
+	for _, arg := range args.Words() {
+		if p, ok := historyPeriods[strings.ToLower(arg)]; ok {
+			period = p
+			break
+		}
+	}
+	// buckets are aligned to UTC midnight, weeks start on a Monday
+	start := time.Now().UTC().Truncate(period.Size).Add(-time.Duration(period.Buckets-1) * period.Size)
+	history := kBot.GetKarmaHistory(ctx, targetID, evt.RoomID.String(), start.UnixMilli(), period.Size.Milliseconds(), period.Buckets)
+
+	var body, bodyHTML strings.Builder
+	spark := Sparkline(history)
+	fmt.Fprintf(&body, "Karma history for %s per %s: %s\n", targetID, period.Name, spark)
+	fmt.Fprintf(&bodyHTML, "Karma history for %s per %s: <code>%s</code><br/>", targetHREF, period.Name, spark)
+	bodyHTML.WriteString("<table><tr><th>from</th><th>karma</th></tr>")
+	for i, karma := range history {
+		date := start.Add(time.Duration(i) * period.Size).Format(period.Layout)
+		fmt.Fprintf(&body, "%s %+d\n", date, karma)
+		fmt.Fprintf(&bodyHTML, "<tr><td>%s</td><td>%+d</td></tr>", html.EscapeString(date), karma)
+	}
+	bodyHTML.WriteString("</table>")
+
+	msg := event.MessageEventContent{
+		MsgType:       event.MsgText,
+		Body:          strings.TrimSpace(body.String()),
+		Format:        event.FormatHTML,
+		FormattedBody: bodyHTML.String(),
+	}
+	kBot.mClient.SendMessageEvent(evt.RoomID, event.EventMessage, &msg)
+	return true
+}
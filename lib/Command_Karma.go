@@ -17,6 +17,7 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 
 	"maunium.net/go/mautrix/event"
@@ -26,18 +27,44 @@ import (
 type Command_Karma struct {
 }
 
+func (u *Command_Karma) Name() string {
+	return "karma"
+}
+
+func (u *Command_Karma) Aliases() []string {
+	return []string{}
+}
+
+func (u *Command_Karma) Summary() string {
+	return "get karma of a user in this room"
+}
+
+func (u *Command_Karma) Args() []KarmaArgSpec {
+	return argsUserWindow
+}
+
 func (u *Command_Karma) NeedsTimer() bool {
 	return true
 }
 
-func (u *Command_Karma) Process(evt *event.Event, kBot *KarmaBot, targetID, targetHREF string) bool {
-	optOut := kBot.IsOptOut(targetID)
+func (u *Command_Karma) PowerLevel() int {
+	return PowerUser
+}
+
+func (u *Command_Karma) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	targetID, targetHREF := args.Target()
+	optOut := kBot.IsOptOut(ctx, targetID)
 	msg := ""
 	if optOut {
 		msg = "Unknown user"
 	} else {
-		karma := kBot.GetKarma(targetID, evt.RoomID.String())
-		msg = fmt.Sprintf("Current karma for %s: %d", targetHREF, karma)
+		window := args.Window()
+		karma := kBot.GetKarma(ctx, targetID, evt.RoomID.String(), window.Since)
+		if window.Since == 0 {
+			msg = fmt.Sprintf("Current karma for %s: %d", targetHREF, karma)
+		} else {
+			msg = fmt.Sprintf("Karma for %s %s: %d", targetHREF, window.Desc, karma)
+		}
 	}
 	msgHTML := format.RenderMarkdown(msg, true, true)
 	kBot.mClient.SendMessageEvent(evt.RoomID, event.EventMessage, &msgHTML)
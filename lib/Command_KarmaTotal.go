@@ -17,6 +17,7 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 
 	"maunium.net/go/mautrix/event"
@@ -26,18 +27,44 @@ import (
 type Command_KarmaTotal struct {
 }
 
+func (u *Command_KarmaTotal) Name() string {
+	return "tkarma"
+}
+
+func (u *Command_KarmaTotal) Aliases() []string {
+	return []string{"totalkarma"}
+}
+
+func (u *Command_KarmaTotal) Summary() string {
+	return "get karma of a user across all rooms"
+}
+
+func (u *Command_KarmaTotal) Args() []KarmaArgSpec {
+	return argsUserWindow
+}
+
 func (u *Command_KarmaTotal) NeedsTimer() bool {
 	return true
 }
 
-func (u *Command_KarmaTotal) Process(evt *event.Event, kBot *KarmaBot, targetID, targetHREF string) bool {
-	optOut := kBot.IsOptOut(targetID)
+func (u *Command_KarmaTotal) PowerLevel() int {
+	return PowerUser
+}
+
+func (u *Command_KarmaTotal) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	targetID, targetHREF := args.Target()
+	optOut := kBot.IsOptOut(ctx, targetID)
 	msg := ""
 	if optOut {
 		msg = "Unknown user"
 	} else {
-		karma := kBot.GetKarmaTotal(targetID)
-		msg = fmt.Sprintf("Current total karma for %s: %d", targetHREF, karma)
+		window := args.Window()
+		karma := kBot.GetKarmaTotal(ctx, targetID, window.Since)
+		if window.Since == 0 {
+			msg = fmt.Sprintf("Current total karma for %s: %d", targetHREF, karma)
+		} else {
+			msg = fmt.Sprintf("Total karma for %s %s: %d", targetHREF, window.Desc, karma)
+		}
 	}
 	msgHTML := format.RenderMarkdown(msg, true, true)
 	kBot.mClient.SendMessageEvent(evt.RoomID, event.EventMessage, &msgHTML)
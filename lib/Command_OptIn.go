@@ -17,17 +17,39 @@
 package lib
 
 import (
+	"context"
+
 	"maunium.net/go/mautrix/event"
 )
 
 type Command_OptIn struct {
 }
 
+func (u *Command_OptIn) Name() string {
+	return "optin"
+}
+
+func (u *Command_OptIn) Aliases() []string {
+	return []string{}
+}
+
+func (u *Command_OptIn) Summary() string {
+	return "allow the sender to be tracked in the karma system (past events are not restored)"
+}
+
+func (u *Command_OptIn) Args() []KarmaArgSpec {
+	return nil
+}
+
 func (u *Command_OptIn) NeedsTimer() bool {
 	return false
 }
 
-func (u *Command_OptIn) Process(evt *event.Event, kBot *KarmaBot, targetID, targetHREF string) bool {
-	kBot.OptIn(evt.Sender.String())
+func (u *Command_OptIn) PowerLevel() int {
+	return PowerUser
+}
+
+func (u *Command_OptIn) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	kBot.OptIn(ctx, evt.Sender.String())
 	return false
 }
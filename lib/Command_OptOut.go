@@ -17,17 +17,39 @@
 package lib
 
 import (
+	"context"
+
 	"maunium.net/go/mautrix/event"
 )
 
 type Command_OptOut struct {
 }
 
+func (u *Command_OptOut) Name() string {
+	return "optout"
+}
+
+func (u *Command_OptOut) Aliases() []string {
+	return []string{}
+}
+
+func (u *Command_OptOut) Summary() string {
+	return "remove the sender from the karma system, all votes given to and by the sender are permanently deleted"
+}
+
+func (u *Command_OptOut) Args() []KarmaArgSpec {
+	return nil
+}
+
 func (u *Command_OptOut) NeedsTimer() bool {
 	return false
 }
 
-func (u *Command_OptOut) Process(evt *event.Event, kBot *KarmaBot, targetID, targetHREF string) bool {
-	kBot.OptOut(evt.Sender.String())
+func (u *Command_OptOut) PowerLevel() int {
+	return PowerUser
+}
+
+func (u *Command_OptOut) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	kBot.OptOut(ctx, evt.Sender.String())
 	return false
 }
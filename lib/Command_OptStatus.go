@@ -17,6 +17,7 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 
 	"maunium.net/go/mautrix/event"
@@ -26,12 +27,33 @@ import (
 type Command_OptStatus struct {
 }
 
+func (u *Command_OptStatus) Name() string {
+	return "optstatus"
+}
+
+func (u *Command_OptStatus) Aliases() []string {
+	return []string{}
+}
+
+func (u *Command_OptStatus) Summary() string {
+	return "check if a user is tracked in the karma system"
+}
+
+func (u *Command_OptStatus) Args() []KarmaArgSpec {
+	return argsUser
+}
+
 func (u *Command_OptStatus) NeedsTimer() bool {
 	return true
 }
 
-func (u *Command_OptStatus) Process(evt *event.Event, kBot *KarmaBot, targetID, targetHREF string) bool {
-	optOut := kBot.IsOptOut(targetID)
+func (u *Command_OptStatus) PowerLevel() int {
+	return PowerUser
+}
+
+func (u *Command_OptStatus) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	targetID, targetHREF := args.Target()
+	optOut := kBot.IsOptOut(ctx, targetID)
 	msg := ""
 	if optOut {
 		msg = fmt.Sprintf("%s is not allowed to be tracked in the karma system", targetHREF)
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+)
+
+type Command_ResetRoom struct {
+}
+
+func (u *Command_ResetRoom) Name() string {
+	return "reset-room"
+}
+
+func (u *Command_ResetRoom) Aliases() []string {
+	return []string{}
+}
+
+func (u *Command_ResetRoom) Summary() string {
+	return "permanently delete all karma given in this room"
+}
+
+func (u *Command_ResetRoom) Args() []KarmaArgSpec {
+	return []KarmaArgSpec{
+		{"confirm", ArgWord, false, "the word confirm, guards against resetting by accident"},
+	}
+}
+
+func (u *Command_ResetRoom) NeedsTimer() bool {
+	return false
+}
+
+func (u *Command_ResetRoom) PowerLevel() int {
+	return PowerAdmin
+}
+
+func (u *Command_ResetRoom) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	roomID := evt.RoomID.String()
+	msg := ""
+	words := args.Words()
+	if len(words) == 0 || strings.ToLower(words[0]) != "confirm" {
+		msg = fmt.Sprintf("This permanently deletes all karma given in this room, run `%s%s confirm` to continue", args.Prefix, u.Name())
+	} else {
+		count := kBot.KarmaDeleteRoom(ctx, roomID)
+		kBot.Audit(ctx, roomID, args.SenderID, "reset-room", fmt.Sprintf("%d votes", count), evt.Timestamp)
+		kBot.logger.Infof("%s removed all %d votes in room %q", args.SenderID, count, roomID)
+		msg = fmt.Sprintf("Removed all %d votes given in this room", count)
+	}
+	msgHTML := format.RenderMarkdown(msg, true, true)
+	kBot.mClient.SendMessageEvent(evt.RoomID, event.EventMessage, &msgHTML)
+	return true
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+	"maunium.net/go/mautrix/id"
+)
+
+type Command_RevokeFrom struct {
+}
+
+func (u *Command_RevokeFrom) Name() string {
+	return "revoke-from"
+}
+
+func (u *Command_RevokeFrom) Aliases() []string {
+	return []string{}
+}
+
+func (u *Command_RevokeFrom) Summary() string {
+	return "remove all the karma a user gave in a room"
+}
+
+func (u *Command_RevokeFrom) Args() []KarmaArgSpec {
+	return []KarmaArgSpec{
+		{"user", ArgUser, false, "user whose votes are removed"},
+		{"room", ArgRoom, true, "room ID or alias, defaults to this room"},
+	}
+}
+
+func (u *Command_RevokeFrom) NeedsTimer() bool {
+	return false
+}
+
+func (u *Command_RevokeFrom) PowerLevel() int {
+	return PowerModerator
+}
+
+// room ID of the room argument, the current room if there is none
+func (kBot *KarmaBot) ArgRoomID(evt *event.Event, args *KarmaArgs) (id.RoomID, error) {
+	rooms := args.OfKind(ArgRoom)
+	if len(rooms) == 0 {
+		return evt.RoomID, nil
+	}
+	room := rooms[0].Room
+	if strings.HasPrefix(room, "!") {
+		return id.RoomID(room), nil
+	}
+	resp, err := kBot.mClient.ResolveAlias(id.RoomAlias(room))
+	if err != nil {
+		return "", err
+	}
+	return resp.RoomID, nil
+}
+
+func (u *Command_RevokeFrom) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	msg := ""
+	users := args.OfKind(ArgUser)
+	roomID, err := kBot.ArgRoomID(evt, args)
+	if len(users) == 0 {
+		msg = fmt.Sprintf("Usage: `%s`", KarmaCommandUsage(args.Prefix, u))
+	} else if err != nil {
+		kBot.logger.Warnf("Error while resolving room %q: %v", args.OfKind(ArgRoom)[0].Room, err)
+		msg = "Unknown room"
+	} else if ok, reason := kBot.CanModerate(roomID, evt.Sender); !ok {
+		kBot.logger.Warnf("Denied revoke-from in room %s to %s: %s", roomID, evt.Sender, reason)
+		msg = reason
+	} else {
+		senderID := users[0].UserID
+		count := kBot.KarmaDeleteSender(ctx, senderID, roomID.String())
+		kBot.Audit(ctx, roomID.String(), args.SenderID, "revoke-from", fmt.Sprintf("%s (%d votes)", senderID, count), evt.Timestamp)
+		kBot.logger.Infof("%s removed %d votes given by %s in room %q", args.SenderID, count, senderID, roomID)
+		msg = fmt.Sprintf("Removed %d votes given by %s", count, users[0].HREF)
+	}
+	msgHTML := format.RenderMarkdown(msg, true, true)
+	kBot.mClient.SendMessageEvent(evt.RoomID, event.EventMessage, &msgHTML)
+	return true
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+)
+
+const KarmaTopDefault = 10
+const KarmaTopMax = 50
+
+type Command_Top struct {
+}
+
+func (u *Command_Top) Name() string {
+	return "top"
+}
+
+func (u *Command_Top) Aliases() []string {
+	return []string{"leaderboard"}
+}
+
+func (u *Command_Top) Summary() string {
+	return "list the users with the most karma in this room"
+}
+
+func (u *Command_Top) Args() []KarmaArgSpec {
+	return argsCountWindow
+}
+
+func (u *Command_Top) NeedsTimer() bool {
+	return true
+}
+
+func (u *Command_Top) PowerLevel() int {
+	return PowerUser
+}
+
+func (u *Command_Top) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	window := args.Window()
+	scores := kBot.GetKarmaTop(ctx, evt.RoomID.String(), window.Since, KarmaTopCount(args), false)
+	SendKarmaTable(evt, kBot, KarmaTableTitle("Top karma in this room", window), scores)
+	return true
+}
+
+// number of rows requested by the sender, defaults to KarmaTopDefault
+func KarmaTopCount(args *KarmaArgs) int {
+	n := args.Int(KarmaTopDefault)
+	if n < 1 {
+		return 1
+	}
+	if n > KarmaTopMax {
+		return KarmaTopMax
+	}
+	return int(n)
+}
+
+func KarmaTableTitle(title string, window KarmaWindow) string {
+	if window.Since == 0 {
+		return title
+	}
+	return title + " " + window.Desc
+}
+
+func SendKarmaTable(evt *event.Event, kBot *KarmaBot, title string, scores []KarmaScore) {
+	var msg strings.Builder
+	if len(scores) == 0 {
+		msg.WriteString("No karma has been recorded yet")
+	} else {
+		fmt.Fprintf(&msg, "**%s**\n\n", title)
+		msg.WriteString("| # | user | karma |\n")
+		msg.WriteString("|---|------|-------|\n")
+		for i, score := range scores {
+			fmt.Fprintf(&msg, "| %d | %s | %d |\n", i+1, UserPill(score.UserID), score.Karma)
+		}
+	}
+	msgHTML := format.RenderMarkdown(msg.String(), true, true)
+	kBot.mClient.SendMessageEvent(evt.RoomID, event.EventMessage, &msgHTML)
+}
@@ -17,6 +17,7 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -26,11 +27,32 @@ import (
 type Command_Uptime struct {
 }
 
+func (u *Command_Uptime) Name() string {
+	return "uptime"
+}
+
+func (u *Command_Uptime) Aliases() []string {
+	return []string{}
+}
+
+func (u *Command_Uptime) Summary() string {
+	return "check how long the bot has been up"
+}
+
+func (u *Command_Uptime) Args() []KarmaArgSpec {
+	return nil
+}
+
 func (u *Command_Uptime) NeedsTimer() bool {
 	return true
 }
 
-func (u *Command_Uptime) Process(evt *event.Event, kBot *KarmaBot, targetID, targetHREF string) bool {
-	kBot.mClient.SendText(evt.RoomID, fmt.Sprintf("I have been up for %v\n", time.Since(BotStartTime).String()))
+func (u *Command_Uptime) PowerLevel() int {
+	return PowerUser
+}
+
+func (u *Command_Uptime) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	stats := kBot.dispatch.Stats()
+	kBot.mClient.SendText(evt.RoomID, fmt.Sprintf("I have been up for %v, %d events are waiting in %d rooms\n", time.Since(BotStartTime).String(), stats.Queued, stats.Rooms))
 	return true
 }
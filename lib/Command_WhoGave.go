@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+
+	"maunium.net/go/mautrix/event"
+)
+
+type Command_WhoGave struct {
+}
+
+func (u *Command_WhoGave) Name() string {
+	return "whogave"
+}
+
+func (u *Command_WhoGave) Aliases() []string {
+	return []string{"givers"}
+}
+
+func (u *Command_WhoGave) Summary() string {
+	return "list who gave the most karma to a user in this room"
+}
+
+func (u *Command_WhoGave) Args() []KarmaArgSpec {
+	return argsUserCountWindow
+}
+
+func (u *Command_WhoGave) NeedsTimer() bool {
+	return true
+}
+
+func (u *Command_WhoGave) PowerLevel() int {
+	return PowerUser
+}
+
+func (u *Command_WhoGave) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	targetID, _ := args.Target()
+	if kBot.IsOptOut(ctx, targetID) {
+		kBot.mClient.SendText(evt.RoomID, "Unknown user")
+		return true
+	}
+	window := args.Window()
+	scores := kBot.GetKarmaGivers(ctx, targetID, evt.RoomID.String(), window.Since, KarmaTopCount(args))
+	SendKarmaTable(evt, kBot, KarmaTableTitle("Karma given to "+targetID+" in this room", window), scores)
+	return true
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+)
+
+type Command_Why struct {
+}
+
+func (u *Command_Why) Name() string {
+	return "why"
+}
+
+func (u *Command_Why) Aliases() []string {
+	return []string{"reasons"}
+}
+
+func (u *Command_Why) Summary() string {
+	return "list the most recent reasons a user was given karma in this room"
+}
+
+func (u *Command_Why) Args() []KarmaArgSpec {
+	return []KarmaArgSpec{
+		{"user", ArgUser, true, "user to look up, defaults to the sender"},
+		{"N", ArgInteger, true, "number of reasons to list, defaults to 10"},
+	}
+}
+
+func (u *Command_Why) NeedsTimer() bool {
+	return true
+}
+
+func (u *Command_Why) PowerLevel() int {
+	return PowerUser
+}
+
+func (u *Command_Why) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	targetID, targetHREF := args.Target()
+	msg := ""
+	if kBot.IsOptOut(ctx, targetID) {
+		msg = "Unknown user"
+	} else {
+		reasons := kBot.GetKarmaReasons(ctx, targetID, evt.RoomID.String(), KarmaTopCount(args))
+		msg = KarmaReasonsTable(targetHREF, reasons)
+	}
+	msgHTML := format.RenderMarkdown(msg, true, true)
+	kBot.mClient.SendMessageEvent(evt.RoomID, event.EventMessage, &msgHTML)
+	return true
+}
+
+func KarmaReasonsTable(targetHREF string, reasons []KarmaReason) string {
+	if len(reasons) == 0 {
+		return fmt.Sprintf("No reasons have been given for the karma of %s yet", targetHREF)
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "Why %s has karma\n\n", targetHREF)
+	msg.WriteString("| date | from | vote | reason |\n")
+	msg.WriteString("|------|------|------|--------|\n")
+	for _, reason := range reasons {
+		date := "unknown"
+		if reason.Timestamp > 0 {
+			date = time.UnixMilli(reason.Timestamp).UTC().Format("2006-01-02")
+		}
+		text := EscapeMarkdown(reason.Reason)
+		fmt.Fprintf(&msg, "| %s | %s | %+d | %s |\n", date, reason.SenderID, reason.Vote, text)
+	}
+	return msg.String()
+}
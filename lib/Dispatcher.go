@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+)
+
+type dispatchJob struct {
+	name string
+	run  func()
+}
+
+// queue depth and counters of a Dispatcher
+type DispatcherStats struct {
+	Queued    int
+	Rooms     int
+	MaxQueued int
+	Processed uint64
+	Panics    uint64
+	Dropped   uint64
+}
+
+// runs event handlers on a fixed number of workers, the events of a room are
+// handled one at a time in the order they were submitted and Submit blocks
+// while maxQueued events are waiting
+type Dispatcher struct {
+	logger    *BotLogger
+	lock      sync.Mutex
+	work      *sync.Cond
+	space     *sync.Cond
+	rooms     map[string][]dispatchJob
+	ready     []string
+	queued    int
+	maxQueued int
+	processed uint64
+	panics    uint64
+	dropped   uint64
+	stopped   bool
+	discard   bool
+	workers   sync.WaitGroup
+}
+
+func NewDispatcher(workers, maxQueued int, logger *BotLogger) *Dispatcher {
+	d := &Dispatcher{
+		logger:    logger,
+		rooms:     map[string][]dispatchJob{},
+		maxQueued: maxQueued,
+	}
+	d.work = sync.NewCond(&d.lock)
+	d.space = sync.NewCond(&d.lock)
+	d.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go d.worker()
+	}
+	return d
+}
+
+// queues run behind the earlier events of roomID, false once stopped
+func (d *Dispatcher) Submit(roomID, name string, run func()) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.queued >= d.maxQueued && !d.stopped {
+		d.logger.Warnf("Dispatch queue is full with %d events, waiting", d.queued)
+		for d.queued >= d.maxQueued && !d.stopped {
+			d.space.Wait()
+		}
+	}
+	if d.stopped {
+		d.logger.Warnf("Dropping %s in room %s, the dispatcher is stopped", name, roomID)
+		return false
+	}
+	pending, active := d.rooms[roomID]
+	d.rooms[roomID] = append(pending, dispatchJob{name, run})
+	d.queued++
+	// a room with pending events is either ready or held by a worker
+	if !active {
+		d.ready = append(d.ready, roomID)
+		d.work.Signal()
+	}
+	return true
+}
+
+func (d *Dispatcher) worker() {
+	defer d.workers.Done()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for {
+		for len(d.ready) == 0 && !d.stopped {
+			d.work.Wait()
+		}
+		if len(d.ready) == 0 {
+			return
+		}
+		roomID := d.ready[0]
+		d.ready = d.ready[1:]
+		job := d.rooms[roomID][0]
+		d.rooms[roomID] = d.rooms[roomID][1:]
+		d.queued--
+		d.space.Signal()
+
+		if d.discard {
+			d.dropped++
+		} else {
+			d.lock.Unlock()
+			ok := d.run(roomID, job)
+			d.lock.Lock()
+
+			d.processed++
+			if !ok {
+				d.panics++
+			}
+		}
+		// other rooms go first before the next event of this one
+		if len(d.rooms[roomID]) > 0 {
+			d.ready = append(d.ready, roomID)
+			d.work.Signal()
+		} else {
+			delete(d.rooms, roomID)
+		}
+	}
+}
+
+// runs job, a panic is logged instead of taking down the bot
+func (d *Dispatcher) run(roomID string, job dispatchJob) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			d.logger.Errorf("Recovered from panic in %s for room %s: %v\n%s", job.name, roomID, r, debug.Stack())
+			ok = false
+		}
+	}()
+	job.run()
+	return true
+}
+
+func (d *Dispatcher) Stats() DispatcherStats {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return DispatcherStats{
+		Queued:    d.queued,
+		Rooms:     len(d.rooms),
+		MaxQueued: d.maxQueued,
+		Processed: d.processed,
+		Panics:    d.panics,
+		Dropped:   d.dropped,
+	}
+}
+
+// stops accepting events and waits for the queued ones to be handled, once
+// ctx is done the events still queued are dropped and false is returned
+func (d *Dispatcher) Stop(ctx context.Context) bool {
+	d.lock.Lock()
+	d.stopped = true
+	d.work.Broadcast()
+	d.space.Broadcast()
+	d.lock.Unlock()
+
+	if d.Wait(ctx) {
+		return true
+	}
+	d.lock.Lock()
+	d.discard = true
+	d.lock.Unlock()
+	return false
+}
+
+// waits for the workers to exit after Stop, false if ctx is done first
+func (d *Dispatcher) Wait(ctx context.Context) bool {
+	drained := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
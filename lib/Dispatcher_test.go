@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcher(t *testing.T) {
+	d := NewDispatcher(4, 10, NewBotLogger())
+	var lock sync.Mutex
+	seen := map[string][]int{}
+
+	////// t1 events of a room run in order, a panic does not stop the room
+	for i := 0; i < 50; i++ {
+		i := i
+		for _, room := range []string{"!a", "!b", "!c"} {
+			room := room
+			d.Submit(room, "test", func() {
+				if i == 10 {
+					panic("boom")
+				}
+				time.Sleep(time.Millisecond)
+				lock.Lock()
+				seen[room] = append(seen[room], i)
+				lock.Unlock()
+			})
+		}
+	}
+	if stats := d.Stats(); stats.Queued > stats.MaxQueued {
+		t.Errorf("t1.1 failure: %+v", stats)
+	}
+
+	////// t2 Stop waits for the queued events and refuses new ones
+	d.Stop(context.Background())
+	for _, room := range []string{"!a", "!b", "!c"} {
+		if len(seen[room]) != 49 {
+			t.Fatalf("t1.2 failure: %v", seen[room])
+		}
+		for j, i := range seen[room] {
+			if j < 10 && i != j || j >= 10 && i != j+1 {
+				t.Errorf("t1.3 failure: %v", seen[room])
+				break
+			}
+		}
+	}
+	stats := d.Stats()
+	if stats.Queued != 0 || stats.Rooms != 0 || stats.Processed != 150 || stats.Panics != 3 {
+		t.Errorf("t2.1 failure: %+v", stats)
+	}
+	if d.Submit("!a", "test", func() {}) {
+		t.Errorf("t2.2 failure")
+	}
+}
+
+// a slow room does not hold up the others
+func TestDispatcherRooms(t *testing.T) {
+	d := NewDispatcher(2, 100, NewBotLogger())
+	defer d.Stop(context.Background())
+	release := make(chan bool)
+	done := make(chan string, 10)
+	d.Submit("!slow", "test", func() { <-release })
+	for i := 0; i < 5; i++ {
+		room := fmt.Sprintf("!room%d", i)
+		d.Submit(room, "test", func() { done <- room })
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("t1 failure")
+		}
+	}
+	close(release)
+}
+
+// Stop gives up on slow handlers once its context is done
+func TestDispatcherStopTimeout(t *testing.T) {
+	d := NewDispatcher(1, 100, NewBotLogger())
+	release := make(chan bool)
+	ran := 0
+	d.Submit("!slow", "test", func() { <-release })
+	for i := 0; i < 5; i++ {
+		d.Submit("!slow", "test", func() { ran++ })
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if d.Stop(ctx) {
+		t.Errorf("t1 failure")
+	}
+	close(release)
+	if !d.Wait(context.Background()) || ran != 0 {
+		t.Errorf("t2 failure: %d", ran)
+	}
+	if stats := d.Stats(); stats.Processed != 1 || stats.Dropped != 5 {
+		t.Errorf("t3 failure: %+v", stats)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"strings"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+)
+
+// the body of an edit event without the "* " fallback prefix clients add
+func EditFallbackBody(content *event.MessageEventContent) *event.MessageEventContent {
+	stripped := *content
+	stripped.RelatesTo = nil
+	stripped.Body = strings.TrimPrefix(content.Body, "* ")
+	stripped.FormattedBody = strings.TrimPrefix(content.FormattedBody, "* ")
+	return &stripped
+}
+
+// re-evaluates the karma of an edited message from its new content, the
+// votes of the original message are replaced and never counted twice
+func EditHandler(ctx context.Context, source mautrix.EventSource, evt *event.Event, kBot *KarmaBot) {
+	kBot.logger.Debugf("Calling EditHandler")
+	content := evt.Content.AsMessage()
+	originalID := content.RelatesTo.GetReplaceID()
+	original, err := kBot.mClient.GetEvent(evt.RoomID, originalID)
+	if err != nil {
+		kBot.logger.Warnf("Error while retrieving edited event: %v", err)
+		return
+	}
+	if original.Sender != evt.Sender {
+		kBot.logger.Warnf("Ignoring edit of %s by %s, the message was sent by %s", originalID, evt.Sender, original.Sender)
+		return
+	}
+	err = original.Content.ParseRaw(event.EventMessage)
+	if err != nil && err != event.ErrContentAlreadyParsed {
+		kBot.logger.Warnf("Error while parsing edited event: %v", err)
+		return
+	}
+	ReevaluateEdit(ctx, kBot, original, content)
+}
+
+// replaces the votes of original, which must already be parsed, with the
+// votes found in the edit content
+func ReevaluateEdit(ctx context.Context, kBot *KarmaBot, original *event.Event, content *event.MessageEventContent) {
+	// commands are not re-run, the karma set by !adjust stays
+	prefix := kBot.CommandPrefix(original.RoomID.String())
+	if strings.HasPrefix(original.Content.AsMessage().Body, prefix) {
+		return
+	}
+
+	newContent := content.NewContent
+	if newContent == nil {
+		newContent = EditFallbackBody(content)
+	} else {
+		copied := *newContent
+		newContent = &copied
+	}
+	// m.new_content does not carry relations, the reply target is still the original one
+	newContent.RelatesTo = original.Content.AsMessage().RelatesTo
+
+	edited := *original
+	edited.Content = event.Content{Parsed: newContent}
+	kBot.KarmaDelete(ctx, original.ID.String(), original.RoomID.String())
+	body, bodyHTML := MessageBodies(&edited, newContent, kBot)
+	if strings.HasPrefix(body, prefix) {
+		return
+	}
+	RunMessageHandlers(ctx, &edited, kBot, body, bodyHTML)
+}
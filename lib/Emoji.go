@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"strings"
+)
+
+const zeroWidthJoiner = '\u200d'
+
+// common shortcodes of the default reactions, mapped to normalized emojis
+var emojiShortcodes = map[string]string{
+	":+1:":                         "👍",
+	":thumbsup:":                   "👍",
+	":-1:":                         "👎",
+	":thumbsdown:":                 "👎",
+	":100:":                        "💯",
+	":heart:":                      "❤",
+	":heart_on_fire:":              "❤‍🔥",
+	":banana:":                     "🍌",
+	":tada:":                       "🎉",
+	":revolving_hearts:":           "💞",
+	":heartpulse:":                 "💗",
+	":heartbeat:":                  "💓",
+	":sparkling_heart:":            "💖",
+	":cupid:":                      "💘",
+	":gift_heart:":                 "💝",
+	":two_hearts:":                 "💕",
+	":heart_eyes_cat:":             "😻",
+	":heart_eyes:":                 "😍",
+	":clap:":                       "👏",
+	":pray:":                       "🙏",
+	":star:":                       "⭐",
+	":broken_heart:":               "💔",
+	":angry:":                      "😠",
+	":imp:":                        "👿",
+	":slightly_frowning_face:":     "🙁",
+	":frowning_face:":              "☹",
+	":face_with_symbols_on_mouth:": "🤬",
+	":cursing_face:":               "🤬",
+	":skull_and_crossbones:":       "☠",
+	":skull:":                      "💀",
+}
+
+func isSkinTone(r rune) bool {
+	return r >= 0x1F3FB && r <= 0x1F3FF
+}
+
+func isVariationSelector(r rune) bool {
+	return r == 0xFE0E || r == 0xFE0F
+}
+
+// canonical form of a reaction key so that presentation variants compare
+// equal: variation selectors, skin tones and gender signs are dropped and
+// known shortcodes become emojis, other ZWJ sequences such as ❤️‍🔥 are kept
+func NormalizeEmoji(key string) string {
+	key = strings.TrimSpace(key)
+	if len(key) > 2 && strings.HasPrefix(key, ":") && strings.HasSuffix(key, ":") {
+		if emoji, ok := emojiShortcodes[strings.ToLower(key)]; ok {
+			return emoji
+		}
+		return key
+	}
+	runes := []rune{}
+	for _, r := range key {
+		if isVariationSelector(r) || isSkinTone(r) {
+			continue
+		}
+		runes = append(runes, r)
+	}
+	normalized := []rune{}
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == zeroWidthJoiner && i+1 < len(runes) && (runes[i+1] == '♀' || runes[i+1] == '♂') {
+			i++
+			continue
+		}
+		normalized = append(normalized, runes[i])
+	}
+	return strings.Trim(string(normalized), string(zeroWidthJoiner))
+}
+
+// normalized form of every emoji in list, empty entries are dropped
+func NormalizeEmojiList(list []string) []string {
+	emojis := []string{}
+	for _, emoji := range list {
+		if emoji = NormalizeEmoji(emoji); emoji != "" {
+			emojis = append(emojis, emoji)
+		}
+	}
+	return emojis
+}
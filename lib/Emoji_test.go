@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeEmoji(t *testing.T) {
+	cases := []struct {
+		a, b string
+	}{
+		{"👍", "👍️"},         // variation selector
+		{"👍🏽", "👍"},         // skin tone
+		{":+1:", "👍️"},      // shortcode
+		{":ThumbsUp:", "👍"}, // shortcode case
+		{"❤", "❤️"},         // text and emoji presentation
+		{"❤‍🔥", "❤️‍🔥"},     // ZWJ sequence with and without selector
+		{":heart_on_fire:", "❤️‍🔥"},
+		{"🤷‍♀️", "🤷"},  // gender sign
+		{"🤷🏾‍♂️", "🤷"}, // skin tone and gender sign
+		{"☹", "☹️"},
+		{"☠", "☠️"},
+	}
+	for i, c := range cases {
+		if NormalizeEmoji(c.a) != NormalizeEmoji(c.b) {
+			t.Errorf("t1.%d failure: %q != %q", i+1, NormalizeEmoji(c.a), NormalizeEmoji(c.b))
+		}
+	}
+
+	////// t2 ZWJ sequences stay distinct from their parts
+	if NormalizeEmoji("❤️‍🔥") == NormalizeEmoji("❤️") || NormalizeEmoji("❤️‍🔥") == NormalizeEmoji("🔥") {
+		t.Errorf("t2.1 failure: %q", NormalizeEmoji("❤️‍🔥"))
+	}
+	if NormalizeEmoji("👨‍👩‍👧") != "👨‍👩‍👧" {
+		t.Errorf("t2.2 failure: %q", NormalizeEmoji("👨‍👩‍👧"))
+	}
+
+	////// t3 unknown shortcodes and custom keys are kept
+	if NormalizeEmoji(":party:") != ":party:" || NormalizeEmoji("mxc://example.org/abc") != "mxc://example.org/abc" {
+		t.Errorf("t3 failure")
+	}
+
+	////// t4 every default emoji matches itself without selectors
+	defaults := "❤️,👍️,💯,🍌,🎉,💞,💗,💓,💖,💘,💝,💕,😻,😍,❤️‍🔥,👎️,💔,😠,👿,🙁,☹️,🤬,☠️,💀"
+	normalized := NormalizeEmojiList(strings.Split(defaults, ","))
+	for i, emoji := range strings.Split(defaults, ",") {
+		bare := strings.NewReplacer("\ufe0f", "").Replace(emoji)
+		if NormalizeEmoji(bare) != normalized[i] {
+			t.Errorf("t4 failure: %q", emoji)
+		}
+	}
+}
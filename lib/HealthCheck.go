@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type healthResponse struct {
+	Status       string `json:"status"`
+	Since        string `json:"since"`
+	LastSync     string `json:"last_sync,omitempty"`
+	Failures     int    `json:"failures"`
+	LastError    string `json:"last_error,omitempty"`
+	QueuedEvents int    `json:"queued_events"`
+}
+
+// serves the sync status as JSON on /health, the status code is 503 unless
+// the bot is connected to the homeserver
+func (kBot *KarmaBot) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		status := kBot.syncer.Status()
+		resp := healthResponse{
+			Status:       status.State.String(),
+			Since:        status.Since.UTC().Format(time.RFC3339),
+			Failures:     status.Failures,
+			LastError:    status.LastError,
+			QueuedEvents: kBot.dispatch.Stats().Queued,
+		}
+		if !status.LastSync.IsZero() {
+			resp.LastSync = status.LastSync.UTC().Format(time.RFC3339)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if status.State != SyncConnected {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		err := json.NewEncoder(w).Encode(resp)
+		if err != nil {
+			kBot.logger.Warnf("Error while writing health status: %v", err)
+		}
+	})
+	return mux
+}
+
+// serves HealthHandler on HealthAddress until stopHealthCheck
+func (kBot *KarmaBot) startHealthCheck() {
+	if kBot.kConf.HealthAddress == "" {
+		return
+	}
+	kBot.health = &http.Server{Addr: kBot.kConf.HealthAddress, Handler: kBot.HealthHandler()}
+	go func() {
+		kBot.logger.Infof("Serving health checks on %s", kBot.kConf.HealthAddress)
+		err := kBot.health.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			kBot.logger.Errorf("Error while serving health checks: %v", err)
+		}
+	}()
+}
+
+func (kBot *KarmaBot) stopHealthCheck() {
+	if kBot.health == nil {
+		return
+	}
+	err := kBot.health.Close()
+	if err != nil {
+		kBot.logger.Warnf("Error while stopping health checks: %v", err)
+	}
+}
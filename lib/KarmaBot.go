@@ -18,7 +18,10 @@
 package lib
 
 import (
+	"context"
+	"net/http"
 	"path/filepath"
+	"sync"
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
@@ -26,22 +29,45 @@ import (
 )
 
 type KarmaBot struct {
-	kConf   *KarmaConfig
-	logger  *BotLogger
-	mClient *mautrix.Client
-	bDB     *BDBStore
-	sqlDB   *SQLStore
+	kConf    *KarmaConfig
+	logger   *BotLogger
+	mClient  *mautrix.Client
+	bDB      *BDBStore
+	sqlDB    *SQLStore
+	members  *RoomMemberCache
+	settings *RoomSettingsCache
+	emotes   *RoomEmoteCache
+	limiter  *RateLimiter
+	queue    *ReplyQueue
+	dispatch *Dispatcher
+	syncer   *SyncSupervisor
+	health   *http.Server
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+	// UserPowerLevel, replaced in tests that run without a homeserver
+	powerLevel func(roomID id.RoomID, userID id.UserID) (int, error)
 }
 
 func NewKarmaBot(kConf *KarmaConfig) *KarmaBot {
 	kBot := new(KarmaBot)
 	kBot.kConf = kConf
 	kBot.logger = NewBotLogger()
+	kBot.members = NewRoomMemberCache()
+	kBot.settings = NewRoomSettingsCache()
+	kBot.emotes = NewRoomEmoteCache()
+	kBot.limiter = NewRateLimiter()
+	kBot.queue = NewReplyQueue()
+	kBot.dispatch = NewDispatcher(kConf.Workers, kConf.MaxQueuedEvents, kBot.logger)
+	kBot.syncer = NewSyncSupervisor(kConf.SyncBackoffMin, kConf.SyncBackoffMax, kBot.logger)
+	kBot.powerLevel = kBot.UserPowerLevel
 	return kBot
 }
 
-func (kBot *KarmaBot) Start() error {
+// handlers run with a context derived from ctx, cancelling it aborts the
+// work in flight while Stop waits for it
+func (kBot *KarmaBot) Start(ctx context.Context) error {
 	var err error
+	ctx, kBot.cancel = context.WithCancel(ctx)
 	kBot.bDB, err = NewBDBStore(filepath.Join(kBot.kConf.DataDirectory, "badger"), kBot.logger)
 	if err != nil {
 		return err
@@ -62,8 +88,9 @@ func (kBot *KarmaBot) Start() error {
 	}
 	kBot.mClient.Store = kBot.bDB
 	kBot.mClient.Logger = kBot.logger
+	kBot.mClient.Syncer = kBot.syncer
 
-	syncer := kBot.mClient.Syncer.(*mautrix.DefaultSyncer)
+	syncer := kBot.syncer.DefaultSyncer
 
 	if kBot.kConf.Autojoin {
 		syncer.OnEventType(event.StateMember, func(source mautrix.EventSource, evt *event.Event) {
@@ -73,28 +100,65 @@ func (kBot *KarmaBot) Start() error {
 			}
 		})
 	}
+	syncer.OnEventType(event.StateMember, func(source mautrix.EventSource, evt *event.Event) {
+		kBot.members.Invalidate(evt.RoomID)
+	})
+	syncer.OnEventType(StateRoomEmotes, func(source mautrix.EventSource, evt *event.Event) {
+		kBot.emotes.Update(evt)
+	})
+	// karma events leave the sync loop, the dispatcher keeps them in order per room
 	syncer.OnEventType(event.EventMessage, func(source mautrix.EventSource, evt *event.Event) {
-		MessageHandler(source, evt, kBot)
+		kBot.dispatch.Submit(evt.RoomID.String(), "MessageHandler", func() { MessageHandler(ctx, source, evt, kBot) })
 	})
 	syncer.OnEventType(event.EventReaction, func(source mautrix.EventSource, evt *event.Event) {
-		ReactionHandler(source, evt, kBot)
+		kBot.dispatch.Submit(evt.RoomID.String(), "ReactionHandler", func() { ReactionHandler(ctx, source, evt, kBot) })
 	})
 	syncer.OnEventType(event.EventRedaction, func(source mautrix.EventSource, evt *event.Event) {
-		RedactionHandler(source, evt, kBot)
+		kBot.dispatch.Submit(evt.RoomID.String(), "RedactionHandler", func() { RedactionHandler(ctx, source, evt, kBot) })
 	})
-	err = kBot.mClient.Sync()
+	kBot.startHealthCheck()
+	err = kBot.syncer.Run(ctx, kBot.mClient)
 
 	if err != nil {
-		kBot.bDB.Close()
-		kBot.sqlDB.Close()
+		kBot.shutdown()
 	}
 	return err
 }
 
 func (kBot *KarmaBot) Stop() {
+	kBot.syncer.Stop()
 	kBot.mClient.StopSync()
-	kBot.bDB.Close()
-	kBot.sqlDB.Close()
+	kBot.shutdown()
+}
+
+// state of the connection to the homeserver
+func (kBot *KarmaBot) SyncStatus() SyncStatus {
+	return kBot.syncer.Status()
+}
+
+// waits up to ShutdownTimeout in total before closing the databases, the
+// queued events get the first half, then handlers still running have their
+// context cancelled and get the rest to return
+func (kBot *KarmaBot) shutdown() {
+	kBot.stopOnce.Do(func() {
+		kBot.queue.Stop()
+		ctx, cancel := context.WithTimeout(context.Background(), kBot.kConf.ShutdownTimeout)
+		defer cancel()
+		drainCtx, drainCancel := context.WithTimeout(ctx, kBot.kConf.ShutdownTimeout/2)
+		defer drainCancel()
+		if !kBot.dispatch.Stop(drainCtx) {
+			kBot.logger.Warnf("Gave up waiting for event handlers after %v, dropping %d queued events", kBot.kConf.ShutdownTimeout/2, kBot.dispatch.Stats().Queued)
+			kBot.cancel()
+			// handlers without a context still get the rest of the timeout to finish
+			if !kBot.dispatch.Wait(ctx) {
+				kBot.logger.Warnf("Closing the databases with event handlers still running")
+			}
+		}
+		kBot.cancel()
+		kBot.stopHealthCheck()
+		kBot.bDB.Close()
+		kBot.sqlDB.Close()
+	})
 }
 
 func (kBot *KarmaBot) WhoAmI() id.UserID {
@@ -22,6 +22,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"gopkg.in/ini.v1"
 )
@@ -32,18 +33,41 @@ type UnveilInfo struct {
 }
 
 type KarmaConfig struct {
-	Username       string   `ini:"Username"`
-	AccessToken    string   `ini:"AccessToken"`
-	Homeserver     string   `ini:"Homeserver"`
-	Autojoin       bool     `ini:"Autojoin"`
-	DataDirectory  string   `ini:"DataDirectory"`
-	DBtype         string   `ini:"DBtype"`
-	DBdsn          string   `ini:"DBdsn"`
-	ResponseFreq   int64    `ini:"ResponseFreq"`
-	PositiveEmojis string   `ini:"PositiveEmojis"`
-	NegativeEmojis string   `ini:"NegativeEmojis"`
-	UnveilDirs     []string `init:"UnveilDirs"`
-	UnveilInfo     []UnveilInfo
+	Username          string        `ini:"Username"`
+	AccessToken       string        `ini:"AccessToken"`
+	Homeserver        string        `ini:"Homeserver"`
+	Autojoin          bool          `ini:"Autojoin"`
+	DataDirectory     string        `ini:"DataDirectory"`
+	DBtype            string        `ini:"DBtype"`
+	DBdsn             string        `ini:"DBdsn"`
+	ResponseFreq      int64         `ini:"ResponseFreq"`
+	PositiveEmojis    string        `ini:"PositiveEmojis"`
+	NegativeEmojis    string        `ini:"NegativeEmojis"`
+	Reactions         string        `ini:"Reactions"`
+	WeightedVotes     bool          `ini:"WeightedVotes"`
+	MaxVoteWeight     int64         `ini:"MaxVoteWeight"`
+	NoNegativeText    []string      `ini:"NoNegativeText"`
+	MaxVoteTargets    int           `ini:"MaxVoteTargets"`
+	KeepRedactedKarma []string      `ini:"KeepRedactedKarma"`
+	OneReactionVote   bool          `ini:"OneReactionVote"`
+	MaxVotesPerTarget int           `ini:"MaxVotesPerTarget"`
+	VoteLimitWindow   time.Duration `ini:"VoteLimitWindow"`
+	DiminishingVotes  bool          `ini:"DiminishingVotes"`
+	UserRateLimit     string        `ini:"UserRateLimit"`
+	CommandRateLimit  string        `ini:"CommandRateLimit"`
+	ThrottleFeedback  string        `ini:"ThrottleFeedback"`
+	ThrottleEmoji     string        `ini:"ThrottleEmoji"`
+	Workers           int           `ini:"Workers"`
+	MaxQueuedEvents   int           `ini:"MaxQueuedEvents"`
+	ShutdownTimeout   time.Duration `ini:"ShutdownTimeout"`
+	SyncBackoffMin    time.Duration `ini:"SyncBackoffMin"`
+	SyncBackoffMax    time.Duration `ini:"SyncBackoffMax"`
+	HealthAddress     string        `ini:"HealthAddress"`
+	UserLimit         RateLimit
+	CommandLimit      RateLimit
+	Admins            []string `ini:"Admins"`
+	UnveilDirs        []string `init:"UnveilDirs"`
+	UnveilInfo        []UnveilInfo
 }
 
 func ReadConfig(ConfigFile string) (*KarmaConfig, error) {
@@ -65,6 +89,26 @@ func ReadConfig(ConfigFile string) (*KarmaConfig, error) {
 	cfg.ResponseFreq = 5000000 // 5 seconds
 	cfg.PositiveEmojis = "❤️,👍️,💯,🍌,🎉,💞,💗,💓,💖,💘,💝,💕,😻,😍,❤️‍🔥"
 	cfg.NegativeEmojis = "👎️,💔,😠,👿,🙁,☹️,🤬,☠️,💀"
+	cfg.Reactions = ""
+	cfg.WeightedVotes = false
+	cfg.MaxVoteWeight = 5
+	cfg.NoNegativeText = []string{}
+	cfg.MaxVoteTargets = 5
+	cfg.KeepRedactedKarma = []string{}
+	cfg.OneReactionVote = true
+	cfg.MaxVotesPerTarget = 0
+	cfg.VoteLimitWindow = 24 * time.Hour
+	cfg.DiminishingVotes = false
+	cfg.UserRateLimit = "6/1m"
+	cfg.CommandRateLimit = "4/1m"
+	cfg.ThrottleFeedback = "react"
+	cfg.ThrottleEmoji = "⏳"
+	cfg.Workers = 4
+	cfg.MaxQueuedEvents = 1000
+	cfg.ShutdownTimeout = 10 * time.Second
+	cfg.SyncBackoffMin = 2 * time.Second
+	cfg.SyncBackoffMax = 5 * time.Minute
+	cfg.Admins = []string{}
 	cfg.UnveilDirs = []string{}
 
 	// valid SQL driver name: sqlite3, mysql, pgx
@@ -128,6 +172,70 @@ func ReadConfig(ConfigFile string) (*KarmaConfig, error) {
 		}
 	}
 
+	if cfg.MaxVoteWeight < 1 {
+		err = fmt.Errorf("MaxVoteWeight must be at least 1, got %d", cfg.MaxVoteWeight)
+		goto failed
+	}
+
+	_, err = ParseReactionWeights(cfg.Reactions)
+	if err != nil {
+		err = fmt.Errorf("Could not read Reactions: %v", err)
+		goto failed
+	}
+
+	if cfg.MaxVotesPerTarget < 0 {
+		err = fmt.Errorf("MaxVotesPerTarget can not be negative, got %d", cfg.MaxVotesPerTarget)
+		goto failed
+	}
+
+	if cfg.VoteLimitWindow <= 0 {
+		err = fmt.Errorf("VoteLimitWindow must be positive, got %s", cfg.VoteLimitWindow)
+		goto failed
+	}
+
+	cfg.UserLimit, err = ParseRateLimit(cfg.UserRateLimit)
+	if err != nil {
+		err = fmt.Errorf("Could not read UserRateLimit: %v", err)
+		goto failed
+	}
+
+	cfg.CommandLimit, err = ParseRateLimit(cfg.CommandRateLimit)
+	if err != nil {
+		err = fmt.Errorf("Could not read CommandRateLimit: %v", err)
+		goto failed
+	}
+
+	cfg.ThrottleFeedback, err = normalizeThrottleFeedback(cfg.ThrottleFeedback)
+	if err != nil {
+		err = fmt.Errorf("Could not read ThrottleFeedback: %v", err)
+		goto failed
+	}
+
+	if cfg.MaxVoteTargets < 1 {
+		err = fmt.Errorf("MaxVoteTargets must be at least 1, got %d", cfg.MaxVoteTargets)
+		goto failed
+	}
+
+	if cfg.Workers < 1 {
+		err = fmt.Errorf("Workers must be at least 1, got %d", cfg.Workers)
+		goto failed
+	}
+
+	if cfg.MaxQueuedEvents < 1 {
+		err = fmt.Errorf("MaxQueuedEvents must be at least 1, got %d", cfg.MaxQueuedEvents)
+		goto failed
+	}
+
+	if cfg.ShutdownTimeout <= 0 {
+		err = fmt.Errorf("ShutdownTimeout must be positive, got %v", cfg.ShutdownTimeout)
+		goto failed
+	}
+
+	if cfg.SyncBackoffMin <= 0 || cfg.SyncBackoffMax < cfg.SyncBackoffMin {
+		err = fmt.Errorf("SyncBackoffMin must be positive and at most SyncBackoffMax, got %v and %v", cfg.SyncBackoffMin, cfg.SyncBackoffMax)
+		goto failed
+	}
+
 	i = len(cfg.UnveilDirs)
 	cfg.UnveilInfo = make([]UnveilInfo, i, i)
 	for i, uinfo = range cfg.UnveilDirs {
@@ -18,6 +18,9 @@
 package lib
 
 import (
+	"context"
+	"database/sql"
+
 	"golang.org/x/crypto/blake2b"
 )
 
@@ -29,11 +32,11 @@ func uidHash(userID string) []byte {
 	return uid_key
 }
 
-func (kBot *KarmaBot) IsOptOut(userID string) bool {
+func (kBot *KarmaBot) IsOptOut(ctx context.Context, userID string) bool {
 	uhash := uidHash(userID)
 	query := `SELECT COUNT(*) FROM optout WHERE uidHash = ?`
 	var ucount int64
-	err := kBot.sqlDB.DB.QueryRow(query, uhash).Scan(&ucount)
+	err := kBot.sqlDB.DB.QueryRowContext(ctx, query, uhash).Scan(&ucount)
 	if err == nil && ucount > 0 {
 		return true
 	}
@@ -43,44 +46,45 @@ func (kBot *KarmaBot) IsOptOut(userID string) bool {
 	return false
 }
 
-func (kBot *KarmaBot) OptOut(userID string) {
+func (kBot *KarmaBot) OptOut(ctx context.Context, userID string) {
 	query := `DELETE FROM events WHERE senderID = ? OR targetID = ?`
-	_, err := kBot.sqlDB.DB.Exec(query, userID, userID)
+	_, err := kBot.sqlDB.DB.ExecContext(ctx, query, userID, userID)
 	if err != nil {
 		kBot.logger.Warnf("Error in OptOut while deleting user from events %q: %v", userID, err)
 	}
 	uhash := uidHash(userID)
 	query = `INSERT INTO optout (uidHash) VALUES (?)`
-	_, err = kBot.sqlDB.DB.Exec(query, uhash)
+	_, err = kBot.sqlDB.DB.ExecContext(ctx, query, uhash)
 	if err != nil {
 		kBot.logger.Warnf("Error in OptOut while inserting hash for user %q: %v", userID, err)
 	}
 }
 
-func (kBot *KarmaBot) OptIn(userID string) {
+func (kBot *KarmaBot) OptIn(ctx context.Context, userID string) {
 	uhash := uidHash(userID)
 	query := `DELETE FROM optout WHERE uidHash = ?`
-	_, err := kBot.sqlDB.DB.Exec(query, uhash)
+	_, err := kBot.sqlDB.DB.ExecContext(ctx, query, uhash)
 	if err != nil {
 		kBot.logger.Warnf("Error in OptIn for user %q: %v", userID, err)
 	}
 }
 
-func (kBot *KarmaBot) GetKarma(userID, roomID string) int64 {
-	query := `SELECT SUM(vote) FROM events WHERE targetID = ? AND roomID = ?`
+// since is a unix timestamp in milliseconds, 0 counts all events
+func (kBot *KarmaBot) GetKarma(ctx context.Context, userID, roomID string, since int64) int64 {
+	query := `SELECT COALESCE(SUM(vote), 0) FROM events WHERE targetID = ? AND roomID = ? AND origin_server_ts >= ?`
 	var karma int64
-	err := kBot.sqlDB.DB.QueryRow(query, userID, roomID).Scan(&karma)
+	err := kBot.sqlDB.DB.QueryRowContext(ctx, query, userID, roomID, since).Scan(&karma)
 	if err != nil {
-		kBot.logger.Warnf("Error in GetKarm for user %q: %v", userID, err)
+		kBot.logger.Warnf("Error in GetKarma for user %q: %v", userID, err)
 		karma = 0
 	}
 	return karma
 }
 
-func (kBot *KarmaBot) GetKarmaTotal(userID string) int64 {
-	query := `SELECT SUM(vote) FROM events WHERE targetID = ?`
+func (kBot *KarmaBot) GetKarmaTotal(ctx context.Context, userID string, since int64) int64 {
+	query := `SELECT COALESCE(SUM(vote), 0) FROM events WHERE targetID = ? AND origin_server_ts >= ?`
 	var karma int64
-	err := kBot.sqlDB.DB.QueryRow(query, userID).Scan(&karma)
+	err := kBot.sqlDB.DB.QueryRowContext(ctx, query, userID, since).Scan(&karma)
 	if err != nil {
 		kBot.logger.Warnf("Error in GetKarmaTotal for user %q: %v", userID, err)
 		karma = 0
@@ -89,21 +93,259 @@ func (kBot *KarmaBot) GetKarmaTotal(userID string) int64 {
 	return karma
 }
 
-func (kBot *KarmaBot) KarmaAdd(senderID, targetID, eventID, roomID string, vote int64) {
-	if kBot.IsOptOut(senderID) || kBot.IsOptOut(targetID) || senderID == targetID {
+type KarmaScore struct {
+	UserID string
+	Karma  int64
+}
+
+func (kBot *KarmaBot) scanKarmaScores(ctx context.Context, rows *sql.Rows, limit int) []KarmaScore {
+	scores := []KarmaScore{}
+	for rows.Next() && len(scores) < limit {
+		var score KarmaScore
+		err := rows.Scan(&score.UserID, &score.Karma)
+		if err != nil {
+			kBot.logger.Warnf("Error while scanning karma scores: %v", err)
+			break
+		}
+		if kBot.IsOptOut(ctx, score.UserID) {
+			continue
+		}
+		scores = append(scores, score)
+	}
+	return scores
+}
+
+func (kBot *KarmaBot) GetKarmaTop(ctx context.Context, roomID string, since int64, limit int, ascending bool) []KarmaScore {
+	query := `SELECT targetID, SUM(vote) AS karma FROM events WHERE roomID = ? AND origin_server_ts >= ? GROUP BY targetID ORDER BY karma DESC, targetID`
+	if ascending {
+		query = `SELECT targetID, SUM(vote) AS karma FROM events WHERE roomID = ? AND origin_server_ts >= ? GROUP BY targetID ORDER BY karma ASC, targetID`
+	}
+	rows, err := kBot.sqlDB.DB.QueryContext(ctx, query, roomID, since)
+	if err != nil {
+		kBot.logger.Warnf("Error in GetKarmaTop for room %q: %v", roomID, err)
+		return []KarmaScore{}
+	}
+	defer rows.Close()
+	return kBot.scanKarmaScores(ctx, rows, limit)
+}
+
+func (kBot *KarmaBot) GetKarmaTopTotal(ctx context.Context, since int64, limit int, ascending bool) []KarmaScore {
+	query := `SELECT targetID, SUM(vote) AS karma FROM events WHERE origin_server_ts >= ? GROUP BY targetID ORDER BY karma DESC, targetID`
+	if ascending {
+		query = `SELECT targetID, SUM(vote) AS karma FROM events WHERE origin_server_ts >= ? GROUP BY targetID ORDER BY karma ASC, targetID`
+	}
+	rows, err := kBot.sqlDB.DB.QueryContext(ctx, query, since)
+	if err != nil {
+		kBot.logger.Warnf("Error in GetKarmaTopTotal: %v", err)
+		return []KarmaScore{}
+	}
+	defer rows.Close()
+	return kBot.scanKarmaScores(ctx, rows, limit)
+}
+
+// senders who gave the most karma to userID in roomID
+func (kBot *KarmaBot) GetKarmaGivers(ctx context.Context, userID, roomID string, since int64, limit int) []KarmaScore {
+	query := `SELECT senderID, SUM(vote) AS karma FROM events WHERE targetID = ? AND roomID = ? AND origin_server_ts >= ? AND relatesTo <> ? GROUP BY senderID ORDER BY karma DESC, senderID`
+	rows, err := kBot.sqlDB.DB.QueryContext(ctx, query, userID, roomID, since, AdjustRelatesTo)
+	if err != nil {
+		kBot.logger.Warnf("Error in GetKarmaGivers for user %q: %v", userID, err)
+		return []KarmaScore{}
+	}
+	defer rows.Close()
+	return kBot.scanKarmaScores(ctx, rows, limit)
+}
+
+// targets who received the most karma from userID in roomID
+func (kBot *KarmaBot) GetKarmaGiven(ctx context.Context, userID, roomID string, since int64, limit int) []KarmaScore {
+	query := `SELECT targetID, SUM(vote) AS karma FROM events WHERE senderID = ? AND roomID = ? AND origin_server_ts >= ? AND relatesTo <> ? GROUP BY targetID ORDER BY karma DESC, targetID`
+	rows, err := kBot.sqlDB.DB.QueryContext(ctx, query, userID, roomID, since, AdjustRelatesTo)
+	if err != nil {
+		kBot.logger.Warnf("Error in GetKarmaGiven for user %q: %v", userID, err)
+		return []KarmaScore{}
+	}
+	defer rows.Close()
+	return kBot.scanKarmaScores(ctx, rows, limit)
+}
+
+// senders who gave the most positive karma in roomID
+func (kBot *KarmaBot) GetKarmaGenerous(ctx context.Context, roomID string, since int64, limit int) []KarmaScore {
+	query := `SELECT senderID, SUM(CASE WHEN vote > 0 THEN vote ELSE 0 END) AS karma FROM events WHERE roomID = ? AND origin_server_ts >= ? AND relatesTo <> ? GROUP BY senderID ORDER BY karma DESC, senderID`
+	rows, err := kBot.sqlDB.DB.QueryContext(ctx, query, roomID, since, AdjustRelatesTo)
+	if err != nil {
+		kBot.logger.Warnf("Error in GetKarmaGenerous for room %q: %v", roomID, err)
+		return []KarmaScore{}
+	}
+	defer rows.Close()
+	return kBot.scanKarmaScores(ctx, rows, limit)
+}
+
+type KarmaReason struct {
+	SenderID  string
+	Vote      int64
+	Timestamp int64
+	Reason    string
+}
+
+// most recent reasons given along with karma to userID in roomID
+func (kBot *KarmaBot) GetKarmaReasons(ctx context.Context, userID, roomID string, limit int) []KarmaReason {
+	reasons := []KarmaReason{}
+	query := `SELECT senderID, vote, origin_server_ts, reason FROM events WHERE targetID = ? AND roomID = ? AND reason <> '' ORDER BY origin_server_ts DESC`
+	rows, err := kBot.sqlDB.DB.QueryContext(ctx, query, userID, roomID)
+	if err != nil {
+		kBot.logger.Warnf("Error in GetKarmaReasons for user %q: %v", userID, err)
+		return reasons
+	}
+	defer rows.Close()
+	for rows.Next() && len(reasons) < limit {
+		var reason KarmaReason
+		err = rows.Scan(&reason.SenderID, &reason.Vote, &reason.Timestamp, &reason.Reason)
+		if err != nil {
+			kBot.logger.Warnf("Error while scanning karma reasons for user %q: %v", userID, err)
+			break
+		}
+		if kBot.IsOptOut(ctx, reason.SenderID) {
+			continue
+		}
+		reasons = append(reasons, reason)
+	}
+	return reasons
+}
+
+// relatesTo is the message a reaction vote was given to and empty otherwise,
+// timestamp is the origin_server_ts of the event in milliseconds, reason may be empty
+func (kBot *KarmaBot) KarmaAdd(ctx context.Context, senderID, targetID, eventID, roomID, relatesTo string, vote, timestamp int64, reason string) {
+	if kBot.IsOptOut(ctx, senderID) || kBot.IsOptOut(ctx, targetID) || senderID == targetID {
 		return
 	}
-	query := `INSERT INTO events (senderID, targetID, eventID, roomID, vote) VALUES (?, ?, ?, ?, ?)`
-	_, err := kBot.sqlDB.DB.Exec(query, senderID, targetID, eventID, roomID, vote)
+	query := `INSERT INTO events (senderID, targetID, eventID, roomID, relatesTo, vote, origin_server_ts, reason) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := kBot.sqlDB.DB.ExecContext(ctx, query, senderID, targetID, eventID, roomID, relatesTo, vote, timestamp, reason)
 	if err != nil {
-		kBot.logger.Warnf("Error in KarmaAdd for (%s, %s, %s, %s, %d): %v", senderID, targetID, eventID, roomID, vote, err)
+		kBot.logger.Warnf("Error in KarmaAdd for (%s, %s, %s, %s, %s, %d, %d): %v", senderID, targetID, eventID, roomID, relatesTo, vote, timestamp, err)
 	}
 }
 
-func (kBot *KarmaBot) KarmaDelete(eventID, roomID string) {
+func (kBot *KarmaBot) KarmaDelete(ctx context.Context, eventID, roomID string) {
 	query := `DELETE FROM events WHERE eventID = ? AND roomID = ?`
-	_, err := kBot.sqlDB.DB.Exec(query, eventID, roomID)
+	_, err := kBot.sqlDB.DB.ExecContext(ctx, query, eventID, roomID)
 	if err != nil {
 		kBot.logger.Warnf("Error in KarmaDelete for (%s, %s): %v", eventID, roomID, err)
 	}
 }
+
+// sums of votes per bucket of bucketSize milliseconds, starting at since
+func (kBot *KarmaBot) GetKarmaHistory(ctx context.Context, userID, roomID string, since, bucketSize int64, buckets int) []int64 {
+	history := make([]int64, buckets)
+	query := `SELECT origin_server_ts, vote FROM events WHERE targetID = ? AND roomID = ? AND origin_server_ts >= ?`
+	rows, err := kBot.sqlDB.DB.QueryContext(ctx, query, userID, roomID, since)
+	if err != nil {
+		kBot.logger.Warnf("Error in GetKarmaHistory for user %q: %v", userID, err)
+		return history
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ts, vote int64
+		err = rows.Scan(&ts, &vote)
+		if err != nil {
+			kBot.logger.Warnf("Error while scanning karma history for user %q: %v", userID, err)
+			break
+		}
+		i := (ts - since) / bucketSize
+		if i < int64(buckets) {
+			history[i] += vote
+		}
+	}
+	return history
+}
+
+// removes the reaction votes given to the message eventID
+func (kBot *KarmaBot) KarmaDeleteRelated(ctx context.Context, eventID, roomID string) {
+	query := `DELETE FROM events WHERE relatesTo = ? AND roomID = ?`
+	_, err := kBot.sqlDB.DB.ExecContext(ctx, query, eventID, roomID)
+	if err != nil {
+		kBot.logger.Warnf("Error in KarmaDeleteRelated for (%s, %s): %v", eventID, roomID, err)
+	}
+}
+
+// removes every vote senderID gave in roomID, returns how many were removed,
+// karma adjusted by senderID as a moderator is kept
+func (kBot *KarmaBot) KarmaDeleteSender(ctx context.Context, senderID, roomID string) int64 {
+	query := `DELETE FROM events WHERE senderID = ? AND roomID = ? AND relatesTo <> ?`
+	res, err := kBot.sqlDB.DB.ExecContext(ctx, query, senderID, roomID, AdjustRelatesTo)
+	if err != nil {
+		kBot.logger.Warnf("Error in KarmaDeleteSender for (%s, %s): %v", senderID, roomID, err)
+		return 0
+	}
+	count, _ := res.RowsAffected()
+	return count
+}
+
+// removes every vote given in roomID, returns how many were removed
+func (kBot *KarmaBot) KarmaDeleteRoom(ctx context.Context, roomID string) int64 {
+	query := `DELETE FROM events WHERE roomID = ?`
+	res, err := kBot.sqlDB.DB.ExecContext(ctx, query, roomID)
+	if err != nil {
+		kBot.logger.Warnf("Error in KarmaDeleteRoom for %s: %v", roomID, err)
+		return 0
+	}
+	count, _ := res.RowsAffected()
+	return count
+}
+
+// votes senderID already gave by reacting to the message relatesTo
+func (kBot *KarmaBot) CountReactionVotes(ctx context.Context, senderID, relatesTo, roomID string) int64 {
+	query := `SELECT COUNT(*) FROM events WHERE senderID = ? AND relatesTo = ? AND roomID = ?`
+	var count int64
+	err := kBot.sqlDB.DB.QueryRowContext(ctx, query, senderID, relatesTo, roomID).Scan(&count)
+	if err != nil {
+		kBot.logger.Warnf("Error in CountReactionVotes for (%s, %s, %s): %v", senderID, relatesTo, roomID, err)
+	}
+	return count
+}
+
+// thanks senderID gave targetID in roomID from since until before until, unix
+// timestamps in milliseconds, reactions and votes taking karma are left out
+// while thanks weighted down to 0 by diminishing-votes still count as attempts
+func (kBot *KarmaBot) CountThanksBetween(ctx context.Context, senderID, targetID, roomID string, since, until int64) int64 {
+	query := `SELECT COUNT(*) FROM events WHERE senderID = ? AND targetID = ? AND roomID = ? AND origin_server_ts >= ? AND origin_server_ts < ? AND relatesTo = '' AND vote >= 0`
+	var count int64
+	err := kBot.sqlDB.DB.QueryRowContext(ctx, query, senderID, targetID, roomID, since, until).Scan(&count)
+	if err != nil {
+		kBot.logger.Warnf("Error in CountThanksBetween for (%s, %s, %s): %v", senderID, targetID, roomID, err)
+	}
+	return count
+}
+
+// votes senderID gave targetID in roomID from since until before until, unix
+// timestamps in milliseconds, later votes are left out so that re-evaluating
+// an edited message gives the same result
+func (kBot *KarmaBot) CountVotesBetween(ctx context.Context, senderID, targetID, roomID string, since, until int64) int64 {
+	query := `SELECT COUNT(*) FROM events WHERE senderID = ? AND targetID = ? AND roomID = ? AND origin_server_ts >= ? AND origin_server_ts < ? AND relatesTo <> ?`
+	var count int64
+	err := kBot.sqlDB.DB.QueryRowContext(ctx, query, senderID, targetID, roomID, since, until, AdjustRelatesTo).Scan(&count)
+	if err != nil {
+		kBot.logger.Warnf("Error in CountVotesBetween for (%s, %s, %s): %v", senderID, targetID, roomID, err)
+	}
+	return count
+}
+
+// karma adjusted with the !adjust message eventID, keyed by target
+func (kBot *KarmaBot) GetAdjustments(ctx context.Context, eventID, roomID string) []KarmaScore {
+	adjustments := []KarmaScore{}
+	query := `SELECT targetID, vote FROM events WHERE eventID = ? AND roomID = ? AND relatesTo = ?`
+	rows, err := kBot.sqlDB.DB.QueryContext(ctx, query, eventID, roomID, AdjustRelatesTo)
+	if err != nil {
+		kBot.logger.Warnf("Error in GetAdjustments for (%s, %s): %v", eventID, roomID, err)
+		return adjustments
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var adjustment KarmaScore
+		err = rows.Scan(&adjustment.UserID, &adjustment.Karma)
+		if err != nil {
+			kBot.logger.Warnf("Error while scanning adjustments of %s: %v", eventID, err)
+			break
+		}
+		adjustments = append(adjustments, adjustment)
+	}
+	return adjustments
+}
@@ -17,24 +17,30 @@
 package lib
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
 )
 
-func TestKarmaUtils(t *testing.T) {
+func newTestKarmaBot(t *testing.T) *KarmaBot {
 	dbDir, err := os.MkdirTemp("", "*")
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Logf("Using %q as tempdir", dbDir)
-	defer os.RemoveAll(dbDir)
+	t.Cleanup(func() { os.RemoveAll(dbDir) })
 
 	bLogger := NewBotLogger()
 	sqlStore, err := NewSQLStore("sqlite3", "file:"+filepath.Join(dbDir, "data.sqlite3"), bLogger)
 	if err != nil {
 		t.Fatal(err)
 	}
+	t.Cleanup(sqlStore.Close)
 	err = sqlStore.UpdateDB(SQLKarmaPatches)
 	if err != nil {
 		t.Fatal(err)
@@ -42,6 +48,14 @@ func TestKarmaUtils(t *testing.T) {
 	kBot := new(KarmaBot)
 	kBot.sqlDB = sqlStore
 	kBot.logger = bLogger
+	kBot.settings = NewRoomSettingsCache()
+	kBot.emotes = NewRoomEmoteCache()
+	return kBot
+}
+
+func TestKarmaUtils(t *testing.T) {
+	ctx := context.Background()
+	kBot := newTestKarmaBot(t)
 
 	userA := "@banana-bot:matrix.org"
 	userB := "@jane-doe:matrix.org"
@@ -52,70 +66,378 @@ func TestKarmaUtils(t *testing.T) {
 	vote = 1
 
 	////// t1
-	kBot.KarmaAdd(userA, userB, event, roomA, vote)
-	if kBot.GetKarmaTotal(userB) != 1 {
+	kBot.KarmaAdd(ctx, userA, userB, event, roomA, "", vote, 0, "")
+	if kBot.GetKarmaTotal(ctx, userB, 0) != 1 {
 		t.Errorf("t1.1 failure")
 	}
-	if kBot.GetKarmaTotal(userA) != 0 {
+	if kBot.GetKarmaTotal(ctx, userA, 0) != 0 {
 		t.Errorf("t1.2 failure")
 	}
 
 	////// t2
-	kBot.OptOut(userA)
-	if kBot.GetKarmaTotal(userB) != 0 {
+	kBot.OptOut(ctx, userA)
+	if kBot.GetKarmaTotal(ctx, userB, 0) != 0 {
 		t.Errorf("t2.1 failure")
 	}
-	if kBot.GetKarmaTotal(userA) != 0 {
+	if kBot.GetKarmaTotal(ctx, userA, 0) != 0 {
 		t.Errorf("t2.2 failure")
 	}
 
 	////// t3
-	kBot.KarmaAdd(userA, userB, event, roomA, vote)
-	if kBot.GetKarmaTotal(userB) != 0 {
+	kBot.KarmaAdd(ctx, userA, userB, event, roomA, "", vote, 0, "")
+	if kBot.GetKarmaTotal(ctx, userB, 0) != 0 {
 		t.Errorf("t3.1 failure")
 	}
-	if kBot.GetKarmaTotal(userA) != 0 {
+	if kBot.GetKarmaTotal(ctx, userA, 0) != 0 {
 		t.Errorf("t3.2 failure")
 	}
 
 	////// t4
-	kBot.OptIn(userA)
-	kBot.KarmaAdd(userA, userB, event, roomA, vote)
-	kBot.KarmaAdd(userA, userB, event, roomA, vote)
-	if kBot.GetKarmaTotal(userB) != 1 {
+	kBot.OptIn(ctx, userA)
+	kBot.KarmaAdd(ctx, userA, userB, event, roomA, "", vote, 0, "")
+	kBot.KarmaAdd(ctx, userA, userB, event, roomA, "", vote, 0, "")
+	if kBot.GetKarmaTotal(ctx, userB, 0) != 1 {
 		t.Errorf("t4.1 failure")
 	}
-	if kBot.GetKarmaTotal(userA) != 0 {
+	if kBot.GetKarmaTotal(ctx, userA, 0) != 0 {
 		t.Errorf("t4.2 failure")
 	}
 
 	////// t5
-	kBot.KarmaAdd(userA, userB, event, roomB, vote)
-	if kBot.GetKarmaTotal(userB) != 2 {
+	kBot.KarmaAdd(ctx, userA, userB, event, roomB, "", vote, 0, "")
+	if kBot.GetKarmaTotal(ctx, userB, 0) != 2 {
 		t.Errorf("t5.1 failure")
 	}
-	if kBot.GetKarma(userB, roomA) != 1 {
+	if kBot.GetKarma(ctx, userB, roomA, 0) != 1 {
 		t.Errorf("t5.2 failure")
 	}
-	if kBot.GetKarma(userB, roomB) != 1 {
+	if kBot.GetKarma(ctx, userB, roomB, 0) != 1 {
 		t.Errorf("t5.3 failure")
 	}
-	if kBot.GetKarmaTotal(userA) != 0 {
+	if kBot.GetKarmaTotal(ctx, userA, 0) != 0 {
 		t.Errorf("t5.4 failure")
 	}
 
 	////// t6
-	kBot.KarmaDelete(event, roomA)
-	if kBot.GetKarmaTotal(userB) != 1 {
+	kBot.KarmaDelete(ctx, event, roomA)
+	if kBot.GetKarmaTotal(ctx, userB, 0) != 1 {
 		t.Errorf("t6.1 failure")
 	}
-	if kBot.GetKarma(userB, roomA) != 0 {
+	if kBot.GetKarma(ctx, userB, roomA, 0) != 0 {
 		t.Errorf("t6.2 failure")
 	}
-	if kBot.GetKarma(userB, roomB) != 1 {
+	if kBot.GetKarma(ctx, userB, roomB, 0) != 1 {
 		t.Errorf("t6.3 failure")
 	}
-	if kBot.GetKarmaTotal(userA) != 0 {
+	if kBot.GetKarmaTotal(ctx, userA, 0) != 0 {
 		t.Errorf("t6.4 failure")
 	}
 }
+
+func TestKarmaTop(t *testing.T) {
+	ctx := context.Background()
+	kBot := newTestKarmaBot(t)
+
+	userA := "@banana-bot:matrix.org"
+	userB := "@jane-doe:matrix.org"
+	userC := "@john-doe:matrix.org"
+	roomA := "some-cool-room-matrix.org"
+	roomB := "other-cool-room-matrix.org"
+
+	kBot.KarmaAdd(ctx, userA, userB, "event-1", roomA, "", 1, 0, "")
+	kBot.KarmaAdd(ctx, userC, userB, "event-2", roomA, "", 1, 0, "")
+	kBot.KarmaAdd(ctx, userB, userC, "event-3", roomA, "", 1, 0, "")
+	kBot.KarmaAdd(ctx, userB, userA, "event-4", roomA, "", -1, 0, "")
+	kBot.KarmaAdd(ctx, userB, userC, "event-5", roomB, "", 5, 0, "")
+
+	////// t1
+	top := kBot.GetKarmaTop(ctx, roomA, 0, 10, false)
+	if len(top) != 3 {
+		t.Fatalf("t1.1 failure: %v", top)
+	}
+	if top[0].UserID != userB || top[0].Karma != 2 {
+		t.Errorf("t1.2 failure: %v", top)
+	}
+	if top[2].UserID != userA || top[2].Karma != -1 {
+		t.Errorf("t1.3 failure: %v", top)
+	}
+
+	////// t2
+	bottom := kBot.GetKarmaTop(ctx, roomA, 0, 1, true)
+	if len(bottom) != 1 || bottom[0].UserID != userA {
+		t.Errorf("t2 failure: %v", bottom)
+	}
+
+	////// t3
+	total := kBot.GetKarmaTopTotal(ctx, 0, 10, false)
+	if len(total) != 3 || total[0].UserID != userC || total[0].Karma != 6 {
+		t.Errorf("t3 failure: %v", total)
+	}
+
+	////// t4
+	kBot.OptOut(ctx, userC)
+	top = kBot.GetKarmaTop(ctx, roomA, 0, 10, false)
+	for _, score := range top {
+		if score.UserID == userC {
+			t.Errorf("t4 failure: %v", top)
+		}
+	}
+}
+
+func TestKarmaWindow(t *testing.T) {
+	ctx := context.Background()
+	kBot := newTestKarmaBot(t)
+
+	userA := "@banana-bot:matrix.org"
+	userB := "@jane-doe:matrix.org"
+	roomA := "some-cool-room-matrix.org"
+	day := int64(24 * 60 * 60 * 1000)
+	now := int64(100 * day)
+
+	kBot.KarmaAdd(ctx, userA, userB, "event-1", roomA, "", 1, now-40*day, "")
+	kBot.KarmaAdd(ctx, userA, userB, "event-2", roomA, "", 1, now-10*day, "")
+	kBot.KarmaAdd(ctx, userA, userB, "event-3", roomA, "", 1, now-1*day, "")
+
+	////// t1
+	if kBot.GetKarma(ctx, userB, roomA, 0) != 3 {
+		t.Errorf("t1 failure")
+	}
+
+	////// t2
+	if kBot.GetKarma(ctx, userB, roomA, now-30*day) != 2 {
+		t.Errorf("t2 failure")
+	}
+
+	////// t3
+	if kBot.GetKarmaTotal(ctx, userB, now-7*day) != 1 {
+		t.Errorf("t3 failure")
+	}
+
+	////// t4
+	top := kBot.GetKarmaTop(ctx, roomA, now, 10, false)
+	if len(top) != 0 {
+		t.Errorf("t4 failure: %v", top)
+	}
+}
+
+func TestKarmaHistory(t *testing.T) {
+	ctx := context.Background()
+	kBot := newTestKarmaBot(t)
+
+	userA := "@banana-bot:matrix.org"
+	userB := "@jane-doe:matrix.org"
+	roomA := "some-cool-room-matrix.org"
+	day := int64(24 * 60 * 60 * 1000)
+
+	kBot.KarmaAdd(ctx, userA, userB, "event-1", roomA, "", 1, 10*day, "")
+	kBot.KarmaAdd(ctx, userA, userB, "event-2", roomA, "", 1, 12*day+5, "")
+	kBot.KarmaAdd(ctx, userA, userB, "event-3", roomA, "", -1, 12*day+10, "")
+	kBot.KarmaAdd(ctx, userA, userB, "event-4", roomA, "", 1, 13*day, "")
+	kBot.KarmaAdd(ctx, userA, userB, "event-5", roomA, "", 1, 20*day, "")
+
+	history := kBot.GetKarmaHistory(ctx, userB, roomA, 10*day, day, 4)
+	expected := []int64{1, 0, 0, 1}
+	for i := range expected {
+		if history[i] != expected[i] {
+			t.Errorf("t1 failure: %v", history)
+			break
+		}
+	}
+}
+
+func TestKarmaGivers(t *testing.T) {
+	ctx := context.Background()
+	kBot := newTestKarmaBot(t)
+
+	userA := "@banana-bot:matrix.org"
+	userB := "@jane-doe:matrix.org"
+	userC := "@john-doe:matrix.org"
+	roomA := "some-cool-room-matrix.org"
+
+	kBot.KarmaAdd(ctx, userA, userB, "event-1", roomA, "", 1, 0, "")
+	kBot.KarmaAdd(ctx, userA, userB, "event-2", roomA, "", 1, 0, "")
+	kBot.KarmaAdd(ctx, userC, userB, "event-3", roomA, "", 1, 0, "")
+	kBot.KarmaAdd(ctx, userA, userC, "event-4", roomA, "", -1, 0, "")
+
+	////// t1
+	givers := kBot.GetKarmaGivers(ctx, userB, roomA, 0, 10)
+	if len(givers) != 2 || givers[0].UserID != userA || givers[0].Karma != 2 {
+		t.Errorf("t1 failure: %v", givers)
+	}
+
+	////// t2
+	given := kBot.GetKarmaGiven(ctx, userA, roomA, 0, 10)
+	if len(given) != 2 || given[0].UserID != userB || given[1].UserID != userC || given[1].Karma != -1 {
+		t.Errorf("t2 failure: %v", given)
+	}
+
+	////// t3
+	generous := kBot.GetKarmaGenerous(ctx, roomA, 0, 10)
+	if len(generous) != 2 || generous[0].UserID != userA || generous[0].Karma != 2 {
+		t.Errorf("t3 failure: %v", generous)
+	}
+
+	////// t4
+	kBot.OptOut(ctx, userC)
+	for _, score := range kBot.GetKarmaGivers(ctx, userB, roomA, 0, 10) {
+		if score.UserID == userC {
+			t.Errorf("t4.1 failure")
+		}
+	}
+	for _, score := range kBot.GetKarmaGiven(ctx, userA, roomA, 0, 10) {
+		if score.UserID == userC {
+			t.Errorf("t4.2 failure")
+		}
+	}
+}
+
+func TestKarmaReasons(t *testing.T) {
+	ctx := context.Background()
+	kBot := newTestKarmaBot(t)
+
+	userA := "@banana-bot:matrix.org"
+	userB := "@jane-doe:matrix.org"
+	roomA := "some-cool-room-matrix.org"
+
+	kBot.KarmaAdd(ctx, userA, userB, "event-1", roomA, "", 1, 1000, "fixing CI")
+	kBot.KarmaAdd(ctx, userA, userB, "event-2", roomA, "", 1, 2000, "")
+	kBot.KarmaAdd(ctx, userA, userB, "event-3", roomA, "", 1, 3000, "reviewing")
+
+	////// t1
+	reasons := kBot.GetKarmaReasons(ctx, userB, roomA, 10)
+	if len(reasons) != 2 || reasons[0].Reason != "reviewing" || reasons[1].SenderID != userA {
+		t.Errorf("t1 failure: %v", reasons)
+	}
+
+	////// t2
+	kBot.KarmaDelete(ctx, "event-3", roomA)
+	reasons = kBot.GetKarmaReasons(ctx, userB, roomA, 10)
+	if len(reasons) != 1 || reasons[0].Reason != "fixing CI" {
+		t.Errorf("t2 failure: %v", reasons)
+	}
+}
+
+func TestKarmaMultipleTargets(t *testing.T) {
+	ctx := context.Background()
+	kBot := newTestKarmaBot(t)
+
+	userA := "@banana-bot:matrix.org"
+	userB := "@jane-doe:matrix.org"
+	userC := "@john-doe:matrix.org"
+	roomA := "some-cool-room-matrix.org"
+
+	kBot.KarmaAdd(ctx, userA, userB, "event-1", roomA, "", 1, 0, "")
+	kBot.KarmaAdd(ctx, userA, userC, "event-1", roomA, "", 1, 0, "")
+	kBot.KarmaAdd(ctx, userA, userC, "event-1", roomA, "", 1, 0, "")
+
+	////// t1
+	if kBot.GetKarma(ctx, userB, roomA, 0) != 1 || kBot.GetKarma(ctx, userC, roomA, 0) != 1 {
+		t.Errorf("t1 failure")
+	}
+
+	////// t2
+	kBot.KarmaDelete(ctx, "event-1", roomA)
+	if kBot.GetKarma(ctx, userB, roomA, 0) != 0 || kBot.GetKarma(ctx, userC, roomA, 0) != 0 {
+		t.Errorf("t2 failure")
+	}
+}
+
+func TestKarmaDeleteRelated(t *testing.T) {
+	ctx := context.Background()
+	kBot := newTestKarmaBot(t)
+
+	userA := "@banana-bot:matrix.org"
+	userB := "@jane-doe:matrix.org"
+	userC := "@john-doe:matrix.org"
+	roomA := "some-cool-room-matrix.org"
+
+	kBot.KarmaAdd(ctx, userA, userB, "reaction-1", roomA, "message-1", 1, 0, "")
+	kBot.KarmaAdd(ctx, userC, userB, "reaction-2", roomA, "message-1", 1, 0, "")
+	kBot.KarmaAdd(ctx, userA, userB, "reaction-3", roomA, "message-2", 1, 0, "")
+
+	////// t1
+	kBot.KarmaDeleteRelated(ctx, "message-1", roomA)
+	if kBot.GetKarma(ctx, userB, roomA, 0) != 1 {
+		t.Errorf("t1 failure")
+	}
+
+	////// t2
+	kBot.KarmaDeleteRelated(ctx, "message-2", "other-cool-room-matrix.org")
+	if kBot.GetKarma(ctx, userB, roomA, 0) != 1 {
+		t.Errorf("t2 failure")
+	}
+}
+
+func TestKarmaModeration(t *testing.T) {
+	ctx := context.Background()
+	kBot := newTestKarmaBot(t)
+
+	userA := "@banana-bot:matrix.org"
+	userB := "@jane-doe:matrix.org"
+	userC := "@john-doe:matrix.org"
+	roomA := "some-cool-room-matrix.org"
+	roomB := "other-cool-room-matrix.org"
+
+	kBot.KarmaAdd(ctx, userA, userB, "event-1", roomA, "", 1, 1000, "")
+	kBot.KarmaAdd(ctx, userA, userC, "event-2", roomA, "", 1, 2000, "")
+	kBot.KarmaAdd(ctx, userA, userB, "event-3", roomB, "", 1, 3000, "")
+	kBot.KarmaAdd(ctx, userC, userB, "event-4", roomA, "", 1, 4000, "")
+
+	////// t1 revoking a sender only touches its votes in one room
+	if count := kBot.KarmaDeleteSender(ctx, userA, roomA); count != 2 {
+		t.Errorf("t1.1 failure: %d", count)
+	}
+	if kBot.GetKarma(ctx, userB, roomA, 0) != 1 || kBot.GetKarma(ctx, userB, roomB, 0) != 1 {
+		t.Errorf("t1.2 failure: %d %d", kBot.GetKarma(ctx, userB, roomA, 0), kBot.GetKarma(ctx, userB, roomB, 0))
+	}
+
+	////// t2 resetting a room
+	if count := kBot.KarmaDeleteRoom(ctx, roomA); count != 1 {
+		t.Errorf("t2.1 failure: %d", count)
+	}
+	if kBot.GetKarmaTotal(ctx, userB, 0) != 1 {
+		t.Errorf("t2.2 failure: %d", kBot.GetKarmaTotal(ctx, userB, 0))
+	}
+
+	////// t3 audit log is per room and newest first
+	kBot.Audit(ctx, roomA, userA, "adjust", userB+" +2", 1000)
+	kBot.Audit(ctx, roomA, userA, "reset-room", "1 votes", 2000)
+	kBot.Audit(ctx, roomB, userC, "adjust", userB+" -1", 3000)
+	entries := kBot.GetAuditLog(ctx, roomA, 10)
+	if len(entries) != 2 || entries[0].Action != "reset-room" || entries[1].Arguments != userB+" +2" {
+		t.Errorf("t3.1 failure: %v", entries)
+	}
+	if entries = kBot.GetAuditLog(ctx, roomB, 10); len(entries) != 1 || entries[0].ActorID != userC {
+		t.Errorf("t3.2 failure: %v", entries)
+	}
+	if entries = kBot.GetAuditLog(ctx, roomA, 1); len(entries) != 1 || entries[0].Action != "reset-room" {
+		t.Errorf("t3.3 failure: %v", entries)
+	}
+
+	////// t4 adjustments stay out of the stats of the moderator
+	kBot.kConf = &KarmaConfig{}
+	kBot.KarmaAdd(ctx, userA, userC, "adjust-1", roomB, AdjustRelatesTo, 5, 5000, "cleanup")
+	kBot.KarmaAdd(ctx, userA, userC, "event-5", roomB, "", 1, 6000, "")
+	if given := kBot.GetKarmaGiven(ctx, userA, roomB, 0, 10); len(given) != 2 || given[0].Karma != 1 {
+		t.Errorf("t4.1 failure: %v", given)
+	}
+	if givers := kBot.GetKarmaGivers(ctx, userC, roomB, 0, 10); len(givers) != 1 || givers[0].Karma != 1 {
+		t.Errorf("t4.2 failure: %v", givers)
+	}
+	if generous := kBot.GetKarmaGenerous(ctx, roomB, 0, 10); len(generous) != 1 || generous[0].Karma != 2 {
+		t.Errorf("t4.3 failure: %v", generous)
+	}
+	if count := kBot.KarmaDeleteSender(ctx, userA, roomB); count != 2 || kBot.GetKarma(ctx, userC, roomB, 0) != 5 {
+		t.Errorf("t4.4 failure: %d %d", count, kBot.GetKarma(ctx, userC, roomB, 0))
+	}
+
+	////// t5 redacting an adjustment is audited
+	redaction := &event.Event{RoomID: id.RoomID(roomB), Sender: id.UserID(userC), Redacts: "adjust-1", Timestamp: 7000}
+	RedactionHandler(ctx, mautrix.EventSourceTimeline, redaction, kBot)
+	if kBot.GetKarma(ctx, userC, roomB, 0) != 0 {
+		t.Errorf("t5.1 failure: %d", kBot.GetKarma(ctx, userC, roomB, 0))
+	}
+	if entries = kBot.GetAuditLog(ctx, roomB, 1); len(entries) != 1 || entries[0].Action != "adjust redacted" || entries[0].Arguments != userC+" +5" {
+		t.Errorf("t5.2 failure: %v", entries)
+	}
+}
@@ -17,85 +17,249 @@
 package lib
 
 import (
-	"regexp"
+	"context"
+	"fmt"
 	"strings"
-	"time"
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
 )
 
-var RoomTimers = make(map[string]int64)
+type KarmaArgKind int
+
+const (
+	ArgUser KarmaArgKind = iota
+	ArgInteger
+	ArgWindow
+	ArgWord
+	ArgString
+	ArgRoom
+)
+
+type KarmaArgSpec struct {
+	Name     string
+	Kind     KarmaArgKind
+	Optional bool
+	Help     string
+}
+
+var argsUser = []KarmaArgSpec{
+	{"user", ArgUser, true, "user to look up, defaults to the sender"},
+}
+
+var argsUserWindow = []KarmaArgSpec{
+	{"user", ArgUser, true, "user to look up, defaults to the sender"},
+	{"window", ArgWindow, true, "only count recent karma, e.g. 12h, 7d, 2w or since:2026-01-01"},
+}
+
+var argsCountWindow = []KarmaArgSpec{
+	{"N", ArgInteger, true, "number of users to list, defaults to 10"},
+	{"window", ArgWindow, true, "only count recent karma, e.g. 12h, 7d, 2w or since:2026-01-01"},
+}
+
+var argsUserCountWindow = []KarmaArgSpec{
+	{"user", ArgUser, true, "user to look up, defaults to the sender"},
+	{"N", ArgInteger, true, "number of users to list, defaults to 10"},
+	{"window", ArgWindow, true, "only count recent karma, e.g. 12h, 7d, 2w or since:2026-01-01"},
+}
 
 type KarmaCommand interface {
+	Name() string
+	Aliases() []string
+	Summary() string
+	Args() []KarmaArgSpec
 	NeedsTimer() bool
-	Process(evt *event.Event, kBot *KarmaBot, targetID, targetHREF string) bool
+	PowerLevel() int
+	Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool
 }
 
-var KarmaCommands = map[string]KarmaCommand{
-	"karma":     &Command_Karma{},
-	"tkarma":    &Command_KarmaTotal{},
-	"optin":     &Command_OptIn{},
-	"optout":    &Command_OptOut{},
-	"optstatus": &Command_OptStatus{},
-	"uptime":    &Command_Uptime{},
+var KarmaCommands = []KarmaCommand{
+	&Command_Help{},
+	&Command_Karma{},
+	&Command_KarmaTotal{},
+	&Command_Top{},
+	&Command_Bottom{},
+	&Command_TopTotal{},
+	&Command_History{},
+	&Command_WhoGave{},
+	&Command_Given{},
+	&Command_Generous{},
+	&Command_Why{},
+	&Command_OptIn{},
+	&Command_OptOut{},
+	&Command_OptStatus{},
+	&Command_Uptime{},
+	&Command_Config{},
+	&Command_Adjust{},
+	&Command_RevokeFrom{},
+	&Command_ResetRoom{},
+	&Command_Audit{},
+}
+
+// looks up a command by its name or one of its aliases
+func FindKarmaCommand(name string) (KarmaCommand, bool) {
+	name = strings.ToLower(name)
+	for _, command := range KarmaCommands {
+		if command.Name() == name {
+			return command, true
+		}
+		for _, alias := range command.Aliases() {
+			if alias == name {
+				return command, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// closest command name or alias within a small edit distance, "" if none
+func SuggestKarmaCommand(name string) string {
+	name = strings.ToLower(name)
+	best := ""
+	bestDist := 3
+	for _, command := range KarmaCommands {
+		for _, cname := range append([]string{command.Name()}, command.Aliases()...) {
+			dist := EditDistance(name, cname)
+			if dist < bestDist {
+				best = cname
+				bestDist = dist
+			}
+		}
+	}
+	return best
+}
+
+func KarmaCommandUsage(prefix string, command KarmaCommand) string {
+	usage := prefix + command.Name()
+	for _, arg := range command.Args() {
+		if arg.Optional {
+			usage += " [" + arg.Name + "]"
+		} else {
+			usage += " <" + arg.Name + ">"
+		}
+	}
+	return usage
 }
 
 type KarmaMessageHandler interface {
+	Name() string
 	NeedsTimer() bool
 	FastMatch(body, bodyHTML string) bool
-	ProcessMessage(evt *event.Event, kBot *KarmaBot, body, bodyHTML string) bool
+	ProcessMessage(ctx context.Context, evt *event.Event, kBot *KarmaBot, body, bodyHTML string) bool
 }
 
 var KarmaMessageHandlers = []KarmaMessageHandler{
 	&MessageHandler_ThankYou{},
+	&MessageHandler_Decrement{},
+	&MessageHandler_ReplyThanks{},
 }
 
-func MessageHandler(source mautrix.EventSource, evt *event.Event, kBot *KarmaBot) {
-	if evt.Sender == kBot.WhoAmI() {
-		return
+// cheap check for plain text messages worth resolving mentions in
+func MaybeKarma(body, prefix string) bool {
+	if body == "" {
+		return false
+	}
+	if strings.HasPrefix(body, prefix) {
+		return true
+	}
+	for _, handler := range KarmaMessageHandlers {
+		if handler.FastMatch(body, body) {
+			return true
+		}
+	}
+	return false
+}
+
+// plain and HTML bodies of a message with reply fallbacks removed, bodyHTML
+// is generated from the plain body for clients that do not send HTML
+func MessageBodies(evt *event.Event, content *event.MessageEventContent, kBot *KarmaBot) (string, string) {
+	// quoted replies would otherwise be read as mentions of the quoted sender
+	content.RemoveReplyFallback()
+	body := strings.TrimSpace(content.Body)
+	bodyHTML := strings.TrimSpace(content.FormattedBody)
+	if bodyHTML == "" && MaybeKarma(body, kBot.CommandPrefix(evt.RoomID.String())) {
+		bodyHTML = PlainMentionsToHTML(body, kBot.RoomDisplayNames(evt.RoomID))
 	}
-	body := strings.TrimSpace(evt.Content.AsMessage().Body)
-	bodyHTML := strings.TrimSpace(evt.Content.AsMessage().FormattedBody)
 	if bodyHTML == "" {
 		bodyHTML = body
 	}
-	tnow := time.Now().UnixMicro()
+	return body, bodyHTML
+}
+
+func RunMessageHandlers(ctx context.Context, evt *event.Event, kBot *KarmaBot, body, bodyHTML string) {
 	roomID := evt.RoomID.String()
-	if _, ok := RoomTimers[roomID]; !ok {
-		RoomTimers[roomID] = 0
+	for _, handler := range KarmaMessageHandlers {
+		if !kBot.HandlerEnabled(roomID, handler.Name()) {
+			continue
+		}
+		if !handler.NeedsTimer() {
+			handler.ProcessMessage(ctx, evt, kBot, body, bodyHTML)
+			continue
+		}
+		if !handler.FastMatch(body, bodyHTML) {
+			continue
+		}
+		limits := kBot.ResponseLimits(roomID, evt.Sender.String(), handler.Name())
+		if kBot.limiter.Take(limits) && !handler.ProcessMessage(ctx, evt, kBot, body, bodyHTML) {
+			kBot.limiter.Refund(limits)
+		}
+	}
+}
+
+// runs command once the rate limits allow it, throttled commands get feedback
+func RunCommand(ctx context.Context, evt *event.Event, kBot *KarmaBot, command KarmaCommand, args *KarmaArgs) {
+	limits := kBot.ResponseLimits(evt.RoomID.String(), evt.Sender.String(), command.Name())
+	if command.NeedsTimer() && !kBot.limiter.Take(limits) {
+		kBot.ThrottleCommand(ctx, evt, command, args)
+		return
 	}
-	if body[0] == '!' {
-		rexp := regexp.MustCompile(`(?i)^\!([a-z]+)(\s+.*)?$`)
-		groups := rexp.FindAllStringSubmatch(bodyHTML, -1)
-		if groups == nil || len(groups) != 1 || len(groups[0]) == 0 {
+	runCommand(ctx, evt, kBot, command, args, limits)
+}
+
+// checks the permissions and runs command, its tokens were already taken
+func runCommand(ctx context.Context, evt *event.Event, kBot *KarmaBot, command KarmaCommand, args *KarmaArgs, limits []RateKey) {
+	if ok, reason := kBot.CanRunCommand(evt, command); !ok {
+		kBot.logger.Warnf("Denied %s%s to %s in room %s: %s", args.Prefix, command.Name(), evt.Sender, evt.RoomID, reason)
+		// commands without limits still limit how often they are denied
+		if command.NeedsTimer() || kBot.limiter.Take(limits) {
+			kBot.mClient.SendText(evt.RoomID, reason)
+		}
+		return
+	}
+	if !command.Process(ctx, evt, kBot, args) && command.NeedsTimer() {
+		kBot.limiter.Refund(limits)
+	}
+}
+
+func MessageHandler(ctx context.Context, source mautrix.EventSource, evt *event.Event, kBot *KarmaBot) {
+	if evt.Sender == kBot.WhoAmI() {
+		return
+	}
+	content := evt.Content.AsMessage()
+	if content.OptionalGetRelatesTo().GetReplaceID() != "" {
+		EditHandler(ctx, source, evt, kBot)
+		return
+	}
+	body, bodyHTML := MessageBodies(evt, content, kBot)
+	roomID := evt.RoomID.String()
+	senderID := evt.Sender.String()
+	prefix := kBot.CommandPrefix(roomID)
+	if strings.HasPrefix(body, prefix) {
+		args, ok := ParseCommand(evt.Sender.String(), prefix, body, bodyHTML)
+		if !ok {
 			kBot.logger.Warnf("Could not parse command: %s", bodyHTML)
 			return
 		}
-		commandName := groups[0][1]
-		if command, ok := KarmaCommands[commandName]; ok {
-			href := strings.TrimSpace(groups[0][2])
-			targetID := HTMLToUserID(href)
-			if targetID == "" {
-				targetID = evt.Sender.String()
-				href = targetID
+		command, ok := FindKarmaCommand(args.Command)
+		if !ok {
+			suggestion := SuggestKarmaCommand(args.Command)
+			if suggestion != "" && kBot.limiter.Take(kBot.ResponseLimits(roomID, senderID, "unknown")) {
+				kBot.mClient.SendText(evt.RoomID, fmt.Sprintf("Unknown command %s%s, did you mean %s%s?", prefix, args.Command, prefix, suggestion))
 			}
-			go func() {
-				roomID = evt.RoomID.String()
-				if !command.NeedsTimer() || tnow-RoomTimers[roomID] > kBot.kConf.ResponseFreq {
-					if command.Process(evt, kBot, targetID, href) {
-						RoomTimers[roomID] = tnow
-					}
-				}
-			}()
+			return
 		}
+		RunCommand(ctx, evt, kBot, command, args)
 	} else {
-		for _, handler := range KarmaMessageHandlers {
-			if !handler.NeedsTimer() || (tnow-RoomTimers[roomID] > kBot.kConf.ResponseFreq && handler.FastMatch(body, bodyHTML)) {
-				if handler.ProcessMessage(evt, kBot, body, bodyHTML) {
-					RoomTimers[roomID] = tnow
-				}
-			}
-		}
+		RunMessageHandlers(ctx, evt, kBot, body, bodyHTML)
 	}
 }
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"maunium.net/go/mautrix/event"
+)
+
+type MessageHandler_Decrement struct {
+}
+
+type TextVote struct {
+	TargetID string
+	Vote     int64
+	Reason   string
+}
+
+func (u *MessageHandler_Decrement) Name() string {
+	return "decrement"
+}
+
+func (u *MessageHandler_Decrement) NeedsTimer() bool {
+	return false
+}
+
+func (u *MessageHandler_Decrement) FastMatch(body, bodyHTML string) bool {
+	return strings.Contains(body, "--") || strings.Contains(body, "-=")
+}
+
+// "--" has to follow the pill or its colon directly, "alice -- could you" is a dash
+func (u *MessageHandler_Decrement) Re() *regexp.Regexp {
+	return regexp.MustCompile(`(?i)<a\s+href="[^"]*/([^"/]+)">[^<]+</a>(:?--(?:\s|$|[.,!?])|\s*:?\s*-=\s*([0-9]+))`)
+}
+
+// first decrement found in bodyHTML, "-= N" is only understood when weighted votes are enabled
+func (u *MessageHandler_Decrement) FindVote(bodyHTML string, weighted bool, maxWeight int64) (TextVote, bool) {
+	for _, loc := range u.Re().FindAllStringSubmatchIndex(bodyHTML, -1) {
+		vote := int64(-1)
+		if loc[6] >= 0 {
+			if !weighted {
+				continue
+			}
+			n, err := strconv.ParseInt(bodyHTML[loc[6]:loc[7]], 10, 64)
+			if err != nil || n < 1 {
+				continue
+			}
+			if n > maxWeight {
+				n = maxWeight
+			}
+			vote = -n
+		}
+		targetID, err := url.PathUnescape(bodyHTML[loc[2]:loc[3]])
+		if err != nil {
+			continue
+		}
+		return TextVote{targetID, vote, ThankYouReason(bodyHTML[loc[1]:])}, true
+	}
+	return TextVote{}, false
+}
+
+func (u *MessageHandler_Decrement) ProcessMessage(ctx context.Context, evt *event.Event, kBot *KarmaBot, body, bodyHTML string) bool {
+	if bodyHTML == "" || !kBot.NegativeTextVotes(evt.RoomID.String()) {
+		return false
+	}
+	kBot.logger.Infof("Called MessageHandler_Decrement")
+	vote, ok := u.FindVote(bodyHTML, kBot.kConf.WeightedVotes, kBot.kConf.MaxVoteWeight)
+	if ok {
+		kBot.CastVote(ctx, evt.Sender.String(), vote.TargetID, evt.ID.String(), evt.RoomID.String(), "", vote.Vote, evt.Timestamp, vote.Reason)
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"regexp"
+	"unicode"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+// credits the author of the message being replied to for a bare "thanks!"
+type MessageHandler_ReplyThanks struct {
+}
+
+var bareThanksRegex = regexp.MustCompile(`(?is)^\s*(?:(?:many|big)\s+)?(?:thanks|thank\s+you|thx|ty|cheers)(?:\s+(?:a\s+lot|a\s+bunch|so\s+much|very\s+much))?\b(.*)$`)
+
+func (u *MessageHandler_ReplyThanks) Name() string {
+	return "reply-thanks"
+}
+
+func (u *MessageHandler_ReplyThanks) NeedsTimer() bool {
+	return false
+}
+
+func (u *MessageHandler_ReplyThanks) FastMatch(body, bodyHTML string) bool {
+	return bareThanksRegex.MatchString(body)
+}
+
+// whether body is only a thank you, optionally followed by punctuation,
+// emojis or a reason, and the reason if there is one
+func BareThanks(body string) (bool, string) {
+	groups := bareThanksRegex.FindStringSubmatch(body)
+	if groups == nil {
+		return false, ""
+	}
+	if reason := ThankYouReason(groups[1]); reason != "" {
+		return true, reason
+	}
+	for _, r := range groups[1] {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false, ""
+		}
+	}
+	return true, ""
+}
+
+// the event a message responds to, an explicit reply or the thread it is in,
+// the reply fallback of threads points at the latest message and is ignored
+func ReplyParent(content *event.MessageEventContent) id.EventID {
+	relatesTo := content.OptionalGetRelatesTo()
+	if parent := relatesTo.GetNonFallbackReplyTo(); parent != "" {
+		return parent
+	}
+	return relatesTo.GetThreadParent()
+}
+
+func (u *MessageHandler_ReplyThanks) ProcessMessage(ctx context.Context, evt *event.Event, kBot *KarmaBot, body, bodyHTML string) bool {
+	parentID := ReplyParent(evt.Content.AsMessage())
+	if parentID == "" || pillIDRegex.MatchString(bodyHTML) {
+		return false
+	}
+	ok, reason := BareThanks(body)
+	if !ok {
+		return false
+	}
+	kBot.logger.Infof("Called MessageHandler_ReplyThanks")
+	parent, err := kBot.mClient.GetEvent(evt.RoomID, parentID)
+	if err != nil {
+		kBot.logger.Warnf("Error while retrieving replied to event: %v", err)
+		return false
+	}
+	kBot.CastVote(ctx, evt.Sender.String(), parent.Sender.String(), evt.ID.String(), evt.RoomID.String(), "", 1, evt.Timestamp, reason)
+	return false
+}
@@ -17,7 +17,11 @@
 package lib
 
 import (
+	"context"
+	"html"
+	"net/url"
 	"regexp"
+	"strings"
 
 	"maunium.net/go/mautrix/event"
 )
@@ -25,25 +29,31 @@ import (
 type MessageHandler_ThankYou struct {
 }
 
+const thanksRegexString = `(?:thanks(?:\s+a\s+(?:lot|bunch))?|thank\s+you(?:\s+very\s+much)?)`
+const pillRegexString = `<a\s+href="[^"]*">[^<]+</a>`
+const pillListRegexString = pillRegexString + `(?:\s*(?:,|\band\b|&amp;|&)?\s*` + pillRegexString + `)*`
+
+var pillIDRegex = regexp.MustCompile(`(?i)<a\s+href="[^"]*/([^"/]+)">`)
+
+func (u *MessageHandler_ThankYou) Name() string {
+	return "thanks"
+}
+
 func (u *MessageHandler_ThankYou) NeedsTimer() bool {
 	return false
 }
 
 func (u *MessageHandler_ThankYou) FastMatch(body, bodyHTML string) bool {
-	return bodyHTML != "" && regexp.MustCompile(`(?i)\bthank(s)?\b`).MatchString(body)
+	return bodyHTML != "" && (strings.Contains(body, "++") || regexp.MustCompile(`(?i)\bthank(s)?\b`).MatchString(body))
 }
 
 func (u *MessageHandler_ThankYou) Re() []*regexp.Regexp {
 	return []*regexp.Regexp{
-		regexp.MustCompile(`(?i)(thanks(\s+a\s+(lot|bunch))?|thank\s+you(\s+very\s+much)?)\s+(<a\s+href=".+/(.+)">.+</a>)`),
-		regexp.MustCompile(`(?i)(<a\s+href=".+/(.+)">.+</a>)(\s*:\s*)?\s*(thanks(\s+a\s+(lot|bunch))?|thank\s+you(\s+very\s+much)?|\++)`),
+		regexp.MustCompile(`(?i)` + thanksRegexString + `\s*,?\s+(` + pillListRegexString + `)`),
+		regexp.MustCompile(`(?i)(` + pillListRegexString + `)(?:\s*:\s*)?\s*(?:` + thanksRegexString + `|\+\+)`),
 	}
 }
 
-func (u *MessageHandler_ThankYou) ReIndex() []int {
-	return []int{6, 2}
-}
-
 func (u *MessageHandler_ThankYou) MatchMessage(body string) bool {
 	rexp_arr := u.Re()
 	for _, rexp := range rexp_arr {
@@ -54,31 +64,55 @@ func (u *MessageHandler_ThankYou) MatchMessage(body string) bool {
 	return false
 }
 
-func (u *MessageHandler_ThankYou) ProcessMessage(evt *event.Event, kBot *KarmaBot, body, bodyHTML string) bool {
+const ThankYouReasonMax = 300
+
+var reasonRegex = regexp.MustCompile(`(?is)^\s*(?:for|because)\s+(.+)$`)
+
+// the "for ..." or "because ..." clause following a thank you, if any
+func ThankYouReason(rest string) string {
+	groups := reasonRegex.FindStringSubmatch(rest)
+	if groups == nil {
+		return ""
+	}
+	reason := html.UnescapeString(tagRegex.ReplaceAllString(groups[1], " "))
+	reason = strings.Join(strings.Fields(reason), " ")
+	if runes := []rune(reason); len(runes) > ThankYouReasonMax {
+		reason = string(runes[:ThankYouReasonMax])
+	}
+	return reason
+}
+
+// distinct users thanked in bodyHTML in order of appearance, at most maxTargets
+func (u *MessageHandler_ThankYou) FindVotes(bodyHTML string, maxTargets int) []TextVote {
+	votes := []TextVote{}
+	seen := map[string]bool{}
+	for _, rexp := range u.Re() {
+		for _, loc := range rexp.FindAllStringSubmatchIndex(bodyHTML, -1) {
+			reason := ThankYouReason(bodyHTML[loc[1]:])
+			for _, pill := range pillIDRegex.FindAllStringSubmatch(bodyHTML[loc[2]:loc[3]], -1) {
+				targetID, err := url.PathUnescape(pill[1])
+				if err != nil || targetID == "" || seen[targetID] {
+					continue
+				}
+				if len(votes) >= maxTargets {
+					return votes
+				}
+				seen[targetID] = true
+				votes = append(votes, TextVote{targetID, 1, reason})
+			}
+		}
+	}
+	return votes
+}
+
+func (u *MessageHandler_ThankYou) ProcessMessage(ctx context.Context, evt *event.Event, kBot *KarmaBot, body, bodyHTML string) bool {
 	if bodyHTML == "" {
 		return false
 	}
 	kBot.logger.Infof("Called MessageHandler_ThankYou")
-	rexp_arr := u.Re()
-	rind_arr := u.ReIndex()
 	senderID := evt.Sender.String()
-	for i, rexp := range rexp_arr {
-		groups := rexp.FindAllStringSubmatch(bodyHTML, -1)
-		rind := rind_arr[i]
-		found := false
-		for j := 0; j < len(groups); j++ {
-			targetID := groups[j][rind]
-			if targetID == "" {
-				continue
-			} else {
-				kBot.KarmaAdd(senderID, targetID, evt.ID.String(), evt.RoomID.String(), 1)
-				found = true
-				break
-			}
-		}
-		if found {
-			break
-		}
+	for _, vote := range u.FindVotes(bodyHTML, kBot.kConf.MaxVoteTargets) {
+		kBot.CastVote(ctx, senderID, vote.TargetID, evt.ID.String(), evt.RoomID.String(), "", vote.Vote, evt.Timestamp, vote.Reason)
 	}
 	return false
 }
@@ -0,0 +1,331 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+func TestKarmaCommands(t *testing.T) {
+	////// t1
+	names := map[string]bool{}
+	for _, command := range KarmaCommands {
+		for _, name := range append([]string{command.Name()}, command.Aliases()...) {
+			if names[name] {
+				t.Errorf("t1.1 failure: duplicate command name %q", name)
+			}
+			names[name] = true
+		}
+		if command.Summary() == "" {
+			t.Errorf("t1.2 failure: %q has no summary", command.Name())
+		}
+	}
+
+	////// t2
+	if command, ok := FindKarmaCommand("LEADERBOARD"); !ok || command.Name() != "top" {
+		t.Errorf("t2 failure")
+	}
+
+	////// t3
+	if SuggestKarmaCommand("karam") != "karma" {
+		t.Errorf("t3.1 failure: %q", SuggestKarmaCommand("karam"))
+	}
+	if SuggestKarmaCommand("abcdefgh") != "" {
+		t.Errorf("t3.2 failure: %q", SuggestKarmaCommand("abcdefgh"))
+	}
+
+	////// t4
+	command, _ := FindKarmaCommand("whogave")
+	if KarmaCommandUsage("!", command) != "!whogave [user] [N] [window]" {
+		t.Errorf("t4 failure: %q", KarmaCommandUsage("!", command))
+	}
+}
+
+func TestThankYouReason(t *testing.T) {
+	////// t1
+	if r := ThankYouReason(" for fixing <b>CI</b> &amp; docs"); r != "fixing CI & docs" {
+		t.Errorf("t1 failure: %q", r)
+	}
+
+	////// t2
+	if r := ThankYouReason(" Because you\nhelped"); r != "you helped" {
+		t.Errorf("t2 failure: %q", r)
+	}
+
+	////// t3
+	if r := ThankYouReason(" forever friends"); r != "" {
+		t.Errorf("t3 failure: %q", r)
+	}
+}
+
+func TestDecrementVote(t *testing.T) {
+	u := &MessageHandler_Decrement{}
+	pill := `<a href="https://matrix.to/#/@jane-doe:matrix.org">Jane</a>`
+
+	////// t1
+	vote, ok := u.FindVote(pill+"-- for breaking CI", false, 5)
+	if !ok || vote.TargetID != "@jane-doe:matrix.org" || vote.Vote != -1 || vote.Reason != "breaking CI" {
+		t.Errorf("t1 failure: %v", vote)
+	}
+
+	////// t2
+	if _, ok = u.FindVote(pill+" -= 3", false, 5); ok {
+		t.Errorf("t2 failure")
+	}
+
+	////// t3
+	vote, ok = u.FindVote(pill+": -= 3", true, 5)
+	if !ok || vote.Vote != -3 {
+		t.Errorf("t3.1 failure: %v", vote)
+	}
+	vote, ok = u.FindVote(pill+" -= 30", true, 5)
+	if !ok || vote.Vote != -5 {
+		t.Errorf("t3.2 failure: %v", vote)
+	}
+
+	////// t4
+	if _, ok = u.FindVote("jane-- and "+pill, true, 5); ok {
+		t.Errorf("t4 failure")
+	}
+
+	////// t5 "--" right after the pill or its colon
+	for i, body := range []string{pill + "--", pill + ":--", pill + "--.", pill + "--! oops"} {
+		if vote, ok = u.FindVote(body, false, 5); !ok || vote.Vote != -1 {
+			t.Errorf("t5.%d failure: %v", i+1, vote)
+		}
+	}
+
+	////// t6 "--" used as a dash
+	for i, body := range []string{pill + " -- could you look at this", pill + ": -- see above", pill + "--could you", "hi " + pill + " --verbose"} {
+		if _, ok = u.FindVote(body, true, 5); ok {
+			t.Errorf("t6.%d failure", i+1)
+		}
+	}
+}
+
+func TestThankYouVotes(t *testing.T) {
+	u := &MessageHandler_ThankYou{}
+	pill := func(userID string) string {
+		return `<a href="https://matrix.to/#/` + userID + `">` + userID[1:] + `</a>`
+	}
+	alice := "@alice:matrix.org"
+	bob := "@bob:matrix.org"
+	carol := "@carol:matrix.org"
+	targets := func(votes []TextVote) []string {
+		ids := []string{}
+		for _, vote := range votes {
+			ids = append(ids, vote.TargetID)
+		}
+		return ids
+	}
+
+	////// t1
+	votes := u.FindVotes("thanks "+pill(alice)+", "+pill(bob)+" and "+pill(carol)+" for the release", 5)
+	if ids := targets(votes); len(ids) != 3 || ids[0] != alice || ids[2] != carol {
+		t.Fatalf("t1.1 failure: %v", votes)
+	}
+	if votes[1].Reason != "the release" {
+		t.Errorf("t1.2 failure: %v", votes)
+	}
+
+	////// t2
+	votes = u.FindVotes(pill(alice)+"++ "+pill(bob)+"++ "+pill(alice)+"++", 5)
+	if ids := targets(votes); len(ids) != 2 || ids[0] != alice || ids[1] != bob {
+		t.Errorf("t2 failure: %v", votes)
+	}
+
+	////// t3
+	votes = u.FindVotes("thank you "+pill(alice)+" &amp; "+pill(bob)+" &amp; "+pill(carol), 2)
+	if ids := targets(votes); len(ids) != 2 || ids[1] != bob {
+		t.Errorf("t3 failure: %v", votes)
+	}
+
+	////// t4
+	votes = u.FindVotes(pill(alice)+" said hi to "+pill(bob)+"++", 5)
+	if ids := targets(votes); len(ids) != 1 || ids[0] != bob {
+		t.Errorf("t4 failure: %v", votes)
+	}
+}
+
+func TestBareThanks(t *testing.T) {
+	cases := []struct {
+		body   string
+		ok     bool
+		reason string
+	}{
+		{"thanks!", true, ""},
+		{"Thank you very much 🙏", true, ""},
+		{"ty", true, ""},
+		{"thanks a lot for the quick fix!", true, "the quick fix!"},
+		{"thanks, but that did not work", false, ""},
+		{"thanksgiving is near", false, ""},
+		{"no thanks", false, ""},
+	}
+	for i, c := range cases {
+		ok, reason := BareThanks(c.body)
+		if ok != c.ok || reason != c.reason {
+			t.Errorf("t%d failure: BareThanks(%q) = %v, %q", i+1, c.body, ok, reason)
+		}
+	}
+}
+
+func TestReplyParent(t *testing.T) {
+	////// t1
+	content := &event.MessageEventContent{Body: "thanks"}
+	if ReplyParent(content) != "" {
+		t.Errorf("t1 failure")
+	}
+
+	////// t2
+	content.RelatesTo = (&event.RelatesTo{}).SetReplyTo("$reply")
+	if ReplyParent(content) != "$reply" {
+		t.Errorf("t2 failure")
+	}
+
+	////// t3
+	content.RelatesTo = (&event.RelatesTo{}).SetThread("$root", "$latest")
+	if ReplyParent(content) != "$root" {
+		t.Errorf("t3 failure")
+	}
+
+	////// t4
+	content.RelatesTo = &event.RelatesTo{Type: event.RelThread, EventID: "$root"}
+	if ReplyParent(content) != "$root" {
+		t.Errorf("t4 failure")
+	}
+
+	////// t5 an explicit reply inside a thread
+	content.RelatesTo = &event.RelatesTo{Type: event.RelThread, EventID: "$root", InReplyTo: &event.InReplyTo{EventID: "$answer"}}
+	if ReplyParent(content) != "$answer" {
+		t.Errorf("t5 failure")
+	}
+}
+
+func TestEditFallbackBody(t *testing.T) {
+	content := &event.MessageEventContent{
+		Body:          "* thanks @bob:matrix.org",
+		FormattedBody: `* thanks <a href="https://matrix.to/#/@bob:matrix.org">bob</a>`,
+		RelatesTo:     (&event.RelatesTo{}).SetReplace("$original"),
+	}
+	stripped := EditFallbackBody(content)
+	if stripped.Body != "thanks @bob:matrix.org" || stripped.FormattedBody[0] != 't' || stripped.RelatesTo != nil {
+		t.Errorf("t1 failure: %v", stripped)
+	}
+	if content.Body[0] != '*' {
+		t.Errorf("t2 failure: original content was modified")
+	}
+}
+
+func TestReevaluateEdit(t *testing.T) {
+	ctx := context.Background()
+	kBot := newTestKarmaBot(t)
+	kBot.kConf = &KarmaConfig{MaxVoteTargets: 5}
+	kBot.limiter = NewRateLimiter()
+	roomID := "!room:matrix.org"
+	pill := func(userID string) string {
+		return `<a href="https://matrix.to/#/` + userID + `">` + userID + `</a>`
+	}
+	original := &event.Event{
+		ID:        "$original",
+		RoomID:    "!room:matrix.org",
+		Sender:    "@alice:matrix.org",
+		Timestamp: 1000,
+		Content: event.Content{Parsed: &event.MessageEventContent{
+			MsgType:       event.MsgText,
+			Body:          "thanks @bob:matrix.org",
+			FormattedBody: "thanks " + pill("@bob:matrix.org"),
+		}},
+	}
+	edit := func(body, bodyHTML string) *event.MessageEventContent {
+		return &event.MessageEventContent{
+			MsgType:    event.MsgText,
+			Body:       "* " + body,
+			RelatesTo:  (&event.RelatesTo{}).SetReplace(original.ID),
+			NewContent: &event.MessageEventContent{MsgType: event.MsgText, Body: body, FormattedBody: bodyHTML},
+		}
+	}
+	content := original.Content.AsMessage()
+	RunMessageHandlers(ctx, original, kBot, content.Body, content.FormattedBody)
+	if kBot.GetKarma(ctx, "@bob:matrix.org", roomID, 0) != 1 {
+		t.Fatalf("t0 failure")
+	}
+
+	////// t1 the votes of the edit replace those of the original
+	ReevaluateEdit(ctx, kBot, original, edit("thanks @carol:matrix.org", "thanks "+pill("@carol:matrix.org")))
+	if kBot.GetKarma(ctx, "@bob:matrix.org", roomID, 0) != 0 || kBot.GetKarma(ctx, "@carol:matrix.org", roomID, 0) != 1 {
+		t.Errorf("t1 failure")
+	}
+
+	////// t2 an edit without the thanks takes the karma back
+	ReevaluateEdit(ctx, kBot, original, edit("never mind", "never mind"))
+	if kBot.GetKarma(ctx, "@bob:matrix.org", roomID, 0) != 0 || kBot.GetKarma(ctx, "@carol:matrix.org", roomID, 0) != 0 {
+		t.Errorf("t2 failure")
+	}
+}
+
+func TestCanRunCommand(t *testing.T) {
+	kBot := new(KarmaBot)
+	kBot.logger = NewBotLogger()
+	kBot.kConf = &KarmaConfig{Admins: []string{"@admin:matrix.org"}}
+	config, _ := FindKarmaCommand("config")
+	karma, _ := FindKarmaCommand("karma")
+	if config.PowerLevel() != PowerModerator || karma.PowerLevel() != PowerUser {
+		t.Errorf("t1 failure: %d %d", config.PowerLevel(), karma.PowerLevel())
+	}
+
+	// neither case needs the power levels of the room
+	evt := &event.Event{Sender: "@jane-doe:matrix.org", RoomID: "!room:matrix.org"}
+	if ok, reason := kBot.CanRunCommand(evt, karma); !ok {
+		t.Errorf("t2 failure: %q", reason)
+	}
+	evt.Sender = "@admin:matrix.org"
+	if ok, reason := kBot.CanRunCommand(evt, config); !ok {
+		t.Errorf("t3 failure: %q", reason)
+	}
+
+	////// t4
+	levels := map[id.UserID]int{"@mod:matrix.org": PowerModerator, "@jane-doe:matrix.org": 10}
+	kBot.powerLevel = func(roomID id.RoomID, userID id.UserID) (int, error) {
+		return levels[userID], nil
+	}
+	evt.Sender = "@mod:matrix.org"
+	if ok, reason := kBot.CanRunCommand(evt, config); !ok {
+		t.Errorf("t4.1 failure: %q", reason)
+	}
+	evt.Sender = "@jane-doe:matrix.org"
+	ok, reason := kBot.CanRunCommand(evt, config)
+	if ok || reason != "Sorry, this needs power level 50 in the room and you have 10" {
+		t.Errorf("t4.2 failure: %q", reason)
+	}
+
+	////// t5
+	kBot.powerLevel = func(roomID id.RoomID, userID id.UserID) (int, error) {
+		return 0, errors.New("M_FORBIDDEN")
+	}
+	ok, reason = kBot.CanRunCommand(evt, config)
+	if ok || reason != "Could not check the power levels of the room, power level 50 is needed" {
+		t.Errorf("t5.1 failure: %q", reason)
+	}
+	if ok, _ := kBot.CanRunCommand(evt, karma); !ok {
+		t.Errorf("t5.2 failure")
+	}
+}
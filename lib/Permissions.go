@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"fmt"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+// power levels commands can require, matching the usual client roles
+const (
+	PowerUser      = 0
+	PowerModerator = 50
+	PowerAdmin     = 100
+)
+
+func (kBot *KarmaBot) IsBotAdmin(userID string) bool {
+	return containsString(kBot.kConf.Admins, userID)
+}
+
+// power level of userID in roomID according to its m.room.power_levels state
+func (kBot *KarmaBot) UserPowerLevel(roomID id.RoomID, userID id.UserID) (int, error) {
+	var levels event.PowerLevelsEventContent
+	err := kBot.mClient.StateEvent(roomID, event.StatePowerLevels, "", &levels)
+	if err != nil {
+		return 0, err
+	}
+	return levels.GetUserLevel(userID), nil
+}
+
+// whether userID has at least the required power level in roomID, bot
+// administrators always do and the power levels are only fetched when needed
+func (kBot *KarmaBot) HasPowerLevel(roomID id.RoomID, userID id.UserID, required int) (bool, string) {
+	if required <= PowerUser || kBot.IsBotAdmin(userID.String()) {
+		return true, ""
+	}
+	level, err := kBot.powerLevel(roomID, userID)
+	if err != nil {
+		kBot.logger.Warnf("Error while fetching power levels of room %s: %v", roomID, err)
+		return false, fmt.Sprintf("Could not check the power levels of the room, power level %d is needed", required)
+	}
+	if level < required {
+		return false, fmt.Sprintf("Sorry, this needs power level %d in the room and you have %d", required, level)
+	}
+	return true, ""
+}
+
+func (kBot *KarmaBot) CanRunCommand(evt *event.Event, command KarmaCommand) (bool, string) {
+	return kBot.HasPowerLevel(evt.RoomID, evt.Sender, command.PowerLevel())
+}
+
+func (kBot *KarmaBot) CanModerate(roomID id.RoomID, userID id.UserID) (bool, string) {
+	return kBot.HasPowerLevel(roomID, userID, PowerModerator)
+}
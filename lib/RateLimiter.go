@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how often buckets that refilled completely are forgotten
+const RateLimiterSweep = 10 * time.Minute
+
+// Count responses per Per, a zero Count or Per means no limit
+type RateLimit struct {
+	Count int
+	Per   time.Duration
+}
+
+func (l RateLimit) Unlimited() bool {
+	return l.Count <= 0 || l.Per <= 0
+}
+
+func (l RateLimit) String() string {
+	if l.Unlimited() {
+		return "none"
+	}
+	return fmt.Sprintf("%d/%s", l.Count, l.Per)
+}
+
+// parses limits of the form 5/1m, none or an empty string mean no limit
+func ParseRateLimit(value string) (RateLimit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "none" {
+		return RateLimit{}, nil
+	}
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return RateLimit{}, fmt.Errorf("expected a limit such as 5/1m, got %q", value)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || count < 0 {
+		return RateLimit{}, fmt.Errorf("invalid count in %q", value)
+	}
+	per, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || per <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid duration in %q", value)
+	}
+	return RateLimit{count, per}, nil
+}
+
+type RateKey struct {
+	Key   string
+	Limit RateLimit
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	limit  RateLimit
+}
+
+// refills the bucket up to its limit for the time passed since the last use
+func (b *tokenBucket) refill(now time.Time) {
+	rate := float64(b.limit.Count) / float64(b.limit.Per)
+	b.tokens += float64(now.Sub(b.last)) * rate
+	if b.tokens > float64(b.limit.Count) {
+		b.tokens = float64(b.limit.Count)
+	}
+	b.last = now
+}
+
+// token buckets shared by all the goroutines handling events
+type RateLimiter struct {
+	lock      sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{buckets: map[string]*tokenBucket{}, now: time.Now}
+}
+
+func (rl *RateLimiter) bucket(key RateKey, now time.Time) *tokenBucket {
+	b, ok := rl.buckets[key.Key]
+	if !ok {
+		b = &tokenBucket{float64(key.Limit.Count), now, key.Limit}
+		rl.buckets[key.Key] = b
+	}
+	// the limit may have been reconfigured since, refill caps the tokens
+	b.limit = key.Limit
+	b.refill(now)
+	return b
+}
+
+// takes a token from every bucket, or none of them if one is empty
+func (rl *RateLimiter) Take(keys []RateKey) bool {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	now := rl.now()
+	rl.sweep(now)
+	buckets := []*tokenBucket{}
+	for _, key := range keys {
+		if key.Limit.Unlimited() {
+			continue
+		}
+		b := rl.bucket(key, now)
+		if b.tokens < 1 {
+			return false
+		}
+		buckets = append(buckets, b)
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true
+}
+
+// time until Take can succeed for keys
+func (rl *RateLimiter) Delay(keys []RateKey) time.Duration {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	now := rl.now()
+	delay := time.Duration(0)
+	for _, key := range keys {
+		if key.Limit.Unlimited() {
+			continue
+		}
+		b := rl.bucket(key, now)
+		if b.tokens >= 1 {
+			continue
+		}
+		wait := time.Duration((1 - b.tokens) * float64(key.Limit.Per) / float64(key.Limit.Count))
+		if wait > delay {
+			delay = wait
+		}
+	}
+	return delay
+}
+
+// gives back the tokens of a Take that did not lead to a response
+func (rl *RateLimiter) Refund(keys []RateKey) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	for _, key := range keys {
+		if b, ok := rl.buckets[key.Key]; ok && !key.Limit.Unlimited() {
+			b.tokens++
+			if b.tokens > float64(b.limit.Count) {
+				b.tokens = float64(b.limit.Count)
+			}
+		}
+	}
+}
+
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < RateLimiterSweep {
+		return
+	}
+	rl.lastSweep = now
+	for key, b := range rl.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Count) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// buckets a response has to take a token from: one for the room, one for
+// the sender across all rooms and one for the command or handler in the room
+func (kBot *KarmaBot) ResponseLimits(roomID, senderID, name string) []RateKey {
+	return []RateKey{
+		{"room " + roomID, RateLimit{1, time.Duration(kBot.ResponseFreq(roomID)) * time.Microsecond}},
+		{"user " + senderID, kBot.kConf.UserLimit},
+		{"command " + roomID + " " + name, kBot.kConf.CommandLimit},
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := NewRateLimiter()
+	now := time.Unix(1000, 0)
+	rl.now = func() time.Time { return now }
+	room := RateKey{"room a", RateLimit{1, 5 * time.Second}}
+	user := RateKey{"user a", RateLimit{2, time.Minute}}
+
+	////// t1 room bucket allows one response per 5 seconds
+	if !rl.Take([]RateKey{room}) || rl.Take([]RateKey{room}) {
+		t.Errorf("t1.1 failure")
+	}
+	now = now.Add(5 * time.Second)
+	if !rl.Take([]RateKey{room}) {
+		t.Errorf("t1.2 failure")
+	}
+
+	////// t2 an empty bucket takes no tokens from the others
+	now = now.Add(5 * time.Second)
+	if !rl.Take([]RateKey{user}) || !rl.Take([]RateKey{user}) {
+		t.Errorf("t2.1 failure")
+	}
+	if rl.Take([]RateKey{room, user}) {
+		t.Errorf("t2.2 failure")
+	}
+	if !rl.Take([]RateKey{room}) {
+		t.Errorf("t2.3 failure")
+	}
+
+	////// t3 refunds and partial refills
+	now = now.Add(30 * time.Second)
+	if !rl.Take([]RateKey{user}) || rl.Take([]RateKey{user}) {
+		t.Errorf("t3.1 failure")
+	}
+	rl.Refund([]RateKey{user})
+	if !rl.Take([]RateKey{user}) {
+		t.Errorf("t3.2 failure")
+	}
+
+	////// t4 no limit
+	unlimited := RateKey{"user b", RateLimit{}}
+	for i := 0; i < 100; i++ {
+		if !rl.Take([]RateKey{unlimited}) {
+			t.Fatalf("t4 failure")
+		}
+	}
+
+	////// t5 full buckets are forgotten
+	now = now.Add(time.Hour)
+	rl.Take([]RateKey{room})
+	if _, ok := rl.buckets["user a"]; ok {
+		t.Errorf("t5 failure")
+	}
+
+	////// t6 delay until the next token
+	if d := rl.Delay([]RateKey{room, unlimited}); d != 5*time.Second {
+		t.Errorf("t6.1 failure: %v", d)
+	}
+	now = now.Add(2 * time.Second)
+	if d := rl.Delay([]RateKey{room}); d != 3*time.Second {
+		t.Errorf("t6.2 failure: %v", d)
+	}
+	now = now.Add(3 * time.Second)
+	if d := rl.Delay([]RateKey{room}); d != 0 {
+		t.Errorf("t6.3 failure: %v", d)
+	}
+}
+
+// run with go test -race
+func TestRateLimiterConcurrent(t *testing.T) {
+	rl := NewRateLimiter()
+	keys := []RateKey{
+		{"room a", RateLimit{10, time.Hour}},
+		{"user a", RateLimit{20, time.Hour}},
+	}
+	var taken int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if rl.Take(keys) {
+					atomic.AddInt64(&taken, 1)
+					if j%2 == 0 {
+						rl.Refund(keys)
+						atomic.AddInt64(&taken, -1)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != 10 {
+		t.Errorf("t1 failure: %d", taken)
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	if l, err := ParseRateLimit("5/1m"); err != nil || l != (RateLimit{5, time.Minute}) {
+		t.Errorf("t1 failure: %v %v", l, err)
+	}
+	if l, err := ParseRateLimit("none"); err != nil || !l.Unlimited() {
+		t.Errorf("t2 failure: %v %v", l, err)
+	}
+	for _, value := range []string{"5", "x/1m", "5/soon", "5/-1m", "-1/1m"} {
+		if _, err := ParseRateLimit(value); err == nil {
+			t.Errorf("t3 failure: %q", value)
+		}
+	}
+}
@@ -17,15 +17,87 @@
 package lib
 
 import (
+	"context"
+	"fmt"
+	"strconv"
 	"strings"
 
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
 )
 
-func ReactionHandler(source mautrix.EventSource, evt *event.Event, kBot *KarmaBot) {
+// parses "emoji:weight" pairs such as 💯:2,👍:1,👎:-1
+func ParseReactionWeights(value string) (map[string]int64, error) {
+	weights := map[string]int64{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		// the weight follows the last colon so that keys may contain colons
+		sep := strings.LastIndex(pair, ":")
+		if sep < 1 {
+			return nil, fmt.Errorf("expected emoji:weight, got %q", pair)
+		}
+		weight, err := strconv.ParseInt(strings.TrimSpace(pair[sep+1:]), 10, 64)
+		if err != nil || weight == 0 {
+			return nil, fmt.Errorf("invalid weight in %q", pair)
+		}
+		weights[NormalizeEmoji(pair[:sep])] = weight
+	}
+	return weights, nil
+}
+
+// vote given by reacting with emoji in roomID, weighted reactions take
+// precedence over the plain positive and negative emoji lists and custom
+// emotes not found in either fall back to the image packs of the room
+func (kBot *KarmaBot) ReactionVote(roomID, emoji string) (int64, bool) {
+	emoji = NormalizeEmoji(emoji)
+	value, _ := kBot.GetRoomSetting(roomID, "reactions")
+	weights, err := ParseReactionWeights(value)
+	if err != nil {
+		kBot.logger.Warnf("Invalid reactions %q in room %q: %v", value, roomID, err)
+	}
+	if weight, ok := weights[emoji]; ok {
+		return kBot.weightedVote(roomID, weight)
+	}
+	if containsString(NormalizeEmojiList(kBot.PositiveEmojis(roomID)), emoji) {
+		return 1, true
+	}
+	if containsString(NormalizeEmojiList(kBot.NegativeEmojis(roomID)), emoji) {
+		return -1, true
+	}
+	if IsCustomEmote(emoji) {
+		if weight, ok := kBot.RoomEmoteWeights(id.RoomID(roomID))[emoji]; ok {
+			return kBot.weightedVote(roomID, weight)
+		}
+	}
+	return 0, false
+}
+
+func (kBot *KarmaBot) weightedVote(roomID string, weight int64) (int64, bool) {
+	if weight < 0 && !kBot.roomBool(roomID, "negative-karma") {
+		return 0, false
+	}
+	return weight, true
+}
+
+func ReactionHandler(ctx context.Context, source mautrix.EventSource, evt *event.Event, kBot *KarmaBot) {
+	roomID := evt.RoomID.String()
+	if !kBot.HandlerEnabled(roomID, "reactions") {
+		return
+	}
 	relatesTo := evt.Content.AsReaction().GetRelatesTo()
-	emoji := relatesTo.GetAnnotationKey()
+	vote, ok := int64(0), false
+	for _, key := range ReactionKeys(evt) {
+		if vote, ok = kBot.ReactionVote(roomID, key); ok {
+			break
+		}
+	}
+	if !ok {
+		return
+	}
 	senderID := evt.Sender.String()
 	targetEvent, err := kBot.mClient.GetEvent(evt.RoomID, relatesTo.EventID)
 	if err != nil {
@@ -33,16 +105,5 @@ func ReactionHandler(source mautrix.EventSource, evt *event.Event, kBot *KarmaBo
 		return
 	}
 	targetID := targetEvent.Sender.String()
-	for _, pemoji := range strings.Split(kBot.kConf.PositiveEmojis, ",") {
-		if emoji == pemoji {
-			kBot.KarmaAdd(senderID, targetID, evt.ID.String(), evt.RoomID.String(), 1)
-			return
-		}
-	}
-	for _, nemoji := range strings.Split(kBot.kConf.NegativeEmojis, ",") {
-		if emoji == nemoji {
-			kBot.KarmaAdd(senderID, targetID, evt.ID.String(), evt.RoomID.String(), -1)
-			return
-		}
-	}
+	kBot.CastVote(ctx, senderID, targetID, evt.ID.String(), roomID, relatesTo.EventID.String(), vote, evt.Timestamp, "")
 }
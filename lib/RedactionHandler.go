@@ -17,11 +17,23 @@
 package lib
 
 import (
+	"context"
+	"fmt"
+
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
 )
 
-func RedactionHandler(source mautrix.EventSource, evt *event.Event, kBot *KarmaBot) {
+func RedactionHandler(ctx context.Context, source mautrix.EventSource, evt *event.Event, kBot *KarmaBot) {
 	kBot.logger.Debugf("Calling RedactionHandler")
-	kBot.KarmaDelete(evt.Redacts.String(), evt.RoomID.String())
+	roomID := evt.RoomID.String()
+	adjustments := kBot.GetAdjustments(ctx, evt.Redacts.String(), roomID)
+	kBot.KarmaDelete(ctx, evt.Redacts.String(), roomID)
+	// removing an adjustment is a moderation action of its own
+	for _, adjustment := range adjustments {
+		kBot.Audit(ctx, roomID, evt.Sender.String(), "adjust redacted", fmt.Sprintf("%s %+d", adjustment.UserID, adjustment.Karma), evt.Timestamp)
+	}
+	if kBot.CascadeRedactions(roomID) {
+		kBot.KarmaDeleteRelated(ctx, evt.Redacts.String(), roomID)
+	}
 }
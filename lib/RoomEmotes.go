@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+// image packs of a room (MSC2545), each state key is a separate pack
+var StateRoomEmotes = event.Type{Type: "im.ponies.room_emotes", Class: event.StateEventType}
+
+// field of a pack image holding the karma a reaction with it gives
+const EmoteKarmaField = "bsd.ac.karma"
+
+// how long a fetched default pack is trusted before fetching it again
+const RoomEmotesTTL = 10 * time.Minute
+
+type emotePack struct {
+	Images map[string]struct {
+		URL   string          `json:"url"`
+		Karma json.RawMessage `json:"bsd.ac.karma"`
+	} `json:"images"`
+}
+
+// weights of the emotes tagged with EmoteKarmaField, keyed by both their
+// mxc:// URI and their :shortcode:
+func ParseEmotePack(content json.RawMessage) map[string]int64 {
+	weights := map[string]int64{}
+	var pack emotePack
+	if err := json.Unmarshal(content, &pack); err != nil {
+		return weights
+	}
+	for shortcode, image := range pack.Images {
+		var weight int64
+		if len(image.Karma) == 0 || json.Unmarshal(image.Karma, &weight) != nil || weight == 0 {
+			continue
+		}
+		weights[":"+strings.Trim(shortcode, ":")+":"] = weight
+		if image.URL != "" {
+			weights[image.URL] = weight
+		}
+	}
+	return weights
+}
+
+// weights per pack state key, rooms whose packs were seen in sync are kept up
+// to date by Update and never fetched
+type roomEmotes struct {
+	packs   map[string]map[string]int64
+	synced  bool
+	fetched time.Time
+}
+
+type RoomEmoteCache struct {
+	lock  sync.Mutex
+	rooms map[id.RoomID]*roomEmotes
+}
+
+func NewRoomEmoteCache() *RoomEmoteCache {
+	return &RoomEmoteCache{rooms: map[id.RoomID]*roomEmotes{}}
+}
+
+// must be called with c.lock held
+func (c *RoomEmoteCache) room(roomID id.RoomID) *roomEmotes {
+	emotes, ok := c.rooms[roomID]
+	if !ok {
+		emotes = &roomEmotes{packs: map[string]map[string]int64{}}
+		c.rooms[roomID] = emotes
+	}
+	return emotes
+}
+
+// stores a pack from an image pack state event received in sync
+func (c *RoomEmoteCache) Update(evt *event.Event) {
+	if evt.StateKey == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	emotes := c.room(evt.RoomID)
+	emotes.packs[*evt.StateKey] = ParseEmotePack(evt.Content.VeryRaw)
+	emotes.synced = true
+}
+
+// merged weights of the packs of roomID, false when they have to be fetched
+func (c *RoomEmoteCache) weights(roomID id.RoomID) (map[string]int64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	emotes, ok := c.rooms[roomID]
+	if !ok || !emotes.synced && time.Since(emotes.fetched) >= RoomEmotesTTL {
+		return nil, false
+	}
+	keys := make([]string, 0, len(emotes.packs))
+	for key := range emotes.packs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	weights := map[string]int64{}
+	for _, key := range keys {
+		for emote, weight := range emotes.packs[key] {
+			weights[emote] = weight
+		}
+	}
+	return weights, true
+}
+
+// karma weights of the custom emotes in the image packs of roomID, rooms
+// without pack events since the bot started only have their default pack
+// fetched, failures included it is cached for RoomEmotesTTL
+func (kBot *KarmaBot) RoomEmoteWeights(roomID id.RoomID) map[string]int64 {
+	if weights, ok := kBot.emotes.weights(roomID); ok {
+		return weights
+	}
+	var content json.RawMessage
+	err := kBot.mClient.StateEvent(roomID, StateRoomEmotes, "", &content)
+	pack := map[string]int64{}
+	if err == nil {
+		pack = ParseEmotePack(content)
+	} else if !errors.Is(err, mautrix.MNotFound) {
+		kBot.logger.Warnf("Error while fetching image pack of room %s: %v", roomID, err)
+	}
+
+	c := kBot.emotes
+	c.lock.Lock()
+	emotes := c.room(roomID)
+	if !emotes.synced {
+		emotes.packs[""] = pack
+		emotes.fetched = time.Now()
+	}
+	c.lock.Unlock()
+	weights, _ := c.weights(roomID)
+	return weights
+}
+
+// whether a reaction key refers to a custom emote rather than an emoji
+func IsCustomEmote(key string) bool {
+	return strings.HasPrefix(key, "mxc://") || (len(key) > 2 && strings.HasPrefix(key, ":") && strings.HasSuffix(key, ":"))
+}
+
+// annotation key of a reaction followed by the shortcode some clients send
+// alongside custom emotes
+func ReactionKeys(evt *event.Event) []string {
+	keys := []string{evt.Content.AsReaction().GetRelatesTo().GetAnnotationKey()}
+	for _, field := range []string{"shortcode", "com.beeper.reaction.shortcode"} {
+		if shortcode, ok := evt.Content.Raw[field].(string); ok && shortcode != "" {
+			keys = append(keys, ":"+strings.Trim(shortcode, ":")+":")
+		}
+	}
+	return keys
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+func TestParseEmotePack(t *testing.T) {
+	pack := `{"images": {
+		"party": {"url": "mxc://example.org/party", "bsd.ac.karma": 2},
+		"boo": {"url": "mxc://example.org/boo", "bsd.ac.karma": -1},
+		"cat": {"url": "mxc://example.org/cat"},
+		"odd": {"url": "mxc://example.org/odd", "bsd.ac.karma": "lots"}
+	}}`
+	weights := ParseEmotePack(json.RawMessage(pack))
+	if len(weights) != 4 || weights[":party:"] != 2 || weights["mxc://example.org/party"] != 2 || weights[":boo:"] != -1 {
+		t.Errorf("t1 failure: %v", weights)
+	}
+	if weights := ParseEmotePack(json.RawMessage(`[]`)); len(weights) != 0 {
+		t.Errorf("t2 failure: %v", weights)
+	}
+}
+
+func TestReactionKeys(t *testing.T) {
+	evt := &event.Event{Content: event.Content{
+		Raw: map[string]interface{}{"shortcode": "party"},
+		Parsed: &event.ReactionEventContent{RelatesTo: event.RelatesTo{
+			Type:    event.RelAnnotation,
+			EventID: "$message",
+			Key:     "mxc://example.org/party",
+		}},
+	}}
+	keys := ReactionKeys(evt)
+	if len(keys) != 2 || keys[0] != "mxc://example.org/party" || keys[1] != ":party:" {
+		t.Errorf("t1 failure: %v", keys)
+	}
+}
+
+func TestCustomReactionVote(t *testing.T) {
+	kBot := newTestKarmaBot(t)
+	kBot.kConf = &KarmaConfig{
+		PositiveEmojis: "👍️,mxc://example.org/thumbs,:banana:",
+		Reactions:      "mxc://example.org/star:3",
+	}
+	roomA := "some-cool-room-matrix.org"
+	// packs seen in sync are never fetched from a homeserver
+	kBot.emotes.Update(packEvent(roomA, "", `{"images": {"party": {"url": "mxc://example.org/party", "bsd.ac.karma": 2}}}`))
+	kBot.emotes.Update(packEvent(roomA, "other", `{"images": {"boo": {"url": "mxc://example.org/boo", "bsd.ac.karma": -1}}}`))
+
+	cases := map[string]int64{
+		"mxc://example.org/thumbs": 1,
+		"mxc://example.org/star":   3,
+		":banana:":                 1,
+		":party:":                  2,
+		":boo:":                    -1,
+	}
+	for key, want := range cases {
+		if vote, ok := kBot.ReactionVote(roomA, key); !ok || vote != want {
+			t.Errorf("t1 failure: %s %d", key, vote)
+		}
+	}
+	if _, ok := kBot.ReactionVote(roomA, ":cat:"); ok {
+		t.Errorf("t2 failure")
+	}
+}
+
+func packEvent(roomID, stateKey, content string) *event.Event {
+	return &event.Event{
+		RoomID:   id.RoomID(roomID),
+		Type:     StateRoomEmotes,
+		StateKey: &stateKey,
+		Content:  event.Content{VeryRaw: json.RawMessage(content)},
+	}
+}
+
+func TestRoomEmoteWeights(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"errcode": "M_UNKNOWN", "error": "test"}`))
+	}))
+	defer server.Close()
+	kBot := newTestKarmaBot(t)
+	client, err := mautrix.NewClient(server.URL, "@bot:matrix.org", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kBot.mClient = client
+	roomA := "some-cool-room-matrix.org"
+	roomB := "other-cool-room-matrix.org"
+
+	////// t1 a failed fetch is cached
+	for i := 0; i < 3; i++ {
+		if weights := kBot.RoomEmoteWeights(id.RoomID(roomA)); len(weights) != 0 {
+			t.Errorf("t1.1 failure: %v", weights)
+		}
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("t1.2 failure: %d", requests)
+	}
+
+	////// t2 packs from sync are merged and replaced, without fetching
+	kBot.emotes.Update(packEvent(roomB, "a", `{"images": {"party": {"url": "mxc://example.org/party", "bsd.ac.karma": 2}}}`))
+	kBot.emotes.Update(packEvent(roomB, "b", `{"images": {"boo": {"url": "mxc://example.org/boo", "bsd.ac.karma": -1}}}`))
+	if weights := kBot.RoomEmoteWeights(id.RoomID(roomB)); len(weights) != 4 || weights[":boo:"] != -1 {
+		t.Errorf("t2.1 failure: %v", weights)
+	}
+	kBot.emotes.Update(packEvent(roomB, "a", `{}`))
+	if weights := kBot.RoomEmoteWeights(id.RoomID(roomB)); len(weights) != 2 || weights[":party:"] != 0 {
+		t.Errorf("t2.2 failure: %v", weights)
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("t2.3 failure: %d", requests)
+	}
+}
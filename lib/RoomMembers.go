@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"maunium.net/go/mautrix/id"
+)
+
+// how long the display names of a room are trusted before fetching them again
+const RoomMembersTTL = 10 * time.Minute
+
+// display names shorter than this are too ambiguous to be treated as mentions
+const MinDisplayNameLength = 3
+
+type roomMembers struct {
+	names   map[string]string // lower case display name -> user ID
+	fetched time.Time
+}
+
+type RoomMemberCache struct {
+	lock  sync.Mutex
+	rooms map[id.RoomID]roomMembers
+}
+
+func NewRoomMemberCache() *RoomMemberCache {
+	return &RoomMemberCache{rooms: map[id.RoomID]roomMembers{}}
+}
+
+func (c *RoomMemberCache) Invalidate(roomID id.RoomID) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.rooms, roomID)
+}
+
+// unambiguous display names of the joined members of roomID
+func (kBot *KarmaBot) RoomDisplayNames(roomID id.RoomID) map[string]string {
+	c := kBot.members
+	c.lock.Lock()
+	members, ok := c.rooms[roomID]
+	c.lock.Unlock()
+	if ok && time.Since(members.fetched) < RoomMembersTTL {
+		return members.names
+	}
+
+	resp, err := kBot.mClient.JoinedMembers(roomID)
+	if err != nil {
+		kBot.logger.Warnf("Error while fetching members of room %s: %v", roomID, err)
+		return map[string]string{}
+	}
+	names := map[string]string{}
+	ambiguous := map[string]bool{}
+	for userID, member := range resp.Joined {
+		name := strings.ToLower(strings.TrimSpace(member.DisplayName))
+		if utf8.RuneCountInString(name) < MinDisplayNameLength || ambiguous[name] {
+			continue
+		}
+		if _, dup := names[name]; dup {
+			delete(names, name)
+			ambiguous[name] = true
+			continue
+		}
+		names[name] = userID.String()
+	}
+	c.lock.Lock()
+	c.rooms[roomID] = roomMembers{names, time.Now()}
+	c.lock.Unlock()
+	return names
+}
+
+var plainUserIDRegexString = `@[^\s:<>&"']+:` + serverNameRegexString
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// turns a plain text body into HTML where fully qualified user IDs and the
+// display names in names are replaced by pills, so the same handlers can
+// process messages from clients that do not send a formatted body
+func PlainMentionsToHTML(body string, names map[string]string) string {
+	escaped := html.EscapeString(body)
+	alternatives := []string{"(" + plainUserIDRegexString + ")"}
+	if len(names) > 0 {
+		sorted := make([]string, 0, len(names))
+		for name := range names {
+			sorted = append(sorted, regexp.QuoteMeta(html.EscapeString(name)))
+		}
+		// longer names first so "Jane Doe" wins over "Jane"
+		sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+		alternatives = append(alternatives, "@?("+strings.Join(sorted, "|")+")")
+	}
+	rexp := regexp.MustCompile("(?i)" + strings.Join(alternatives, "|"))
+
+	var out strings.Builder
+	last := 0
+	for _, loc := range rexp.FindAllStringSubmatchIndex(escaped, -1) {
+		userID := ""
+		if loc[2] >= 0 {
+			userID = html.UnescapeString(escaped[loc[2]:loc[3]])
+		} else {
+			before, _ := utf8.DecodeLastRuneInString(escaped[:loc[0]])
+			after, _ := utf8.DecodeRuneInString(escaped[loc[1]:])
+			if isWordRune(before) || isWordRune(after) {
+				continue
+			}
+			name := strings.ToLower(html.UnescapeString(escaped[loc[4]:loc[5]]))
+			userID = names[name]
+		}
+		out.WriteString(escaped[last:loc[0]])
+		out.WriteString(`<a href="https://matrix.to/#/` + html.EscapeString(userID) + `">` + escaped[loc[0]:loc[1]] + `</a>`)
+		last = loc[1]
+	}
+	out.WriteString(escaped[last:])
+	return out.String()
+}
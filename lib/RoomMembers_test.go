@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"testing"
+)
+
+func TestPlainMentionsToHTML(t *testing.T) {
+	names := map[string]string{
+		"jane":     "@jane:matrix.org",
+		"jane doe": "@jane-doe:matrix.org",
+	}
+	u := &MessageHandler_ThankYou{}
+	d := &MessageHandler_Decrement{}
+
+	////// t1
+	votes := u.FindVotes(PlainMentionsToHTML("@alice:example.org++", nil), 5)
+	if len(votes) != 1 || votes[0].TargetID != "@alice:example.org" {
+		t.Errorf("t1 failure: %v", votes)
+	}
+
+	////// t2
+	votes = u.FindVotes(PlainMentionsToHTML("thanks @alice:example.org and Jane Doe <3", names), 5)
+	if len(votes) != 2 || votes[1].TargetID != "@jane-doe:matrix.org" {
+		t.Errorf("t2 failure: %v", votes)
+	}
+
+	////// t3
+	votes = u.FindVotes(PlainMentionsToHTML("thanks @jane", names), 5)
+	if len(votes) != 1 || votes[0].TargetID != "@jane:matrix.org" {
+		t.Errorf("t3 failure: %v", votes)
+	}
+
+	////// t4
+	votes = u.FindVotes(PlainMentionsToHTML("thanks janet", names), 5)
+	if len(votes) != 0 {
+		t.Errorf("t4 failure: %v", votes)
+	}
+
+	////// t5
+	vote, ok := d.FindVote(PlainMentionsToHTML("JANE-- for <b>that</b>", names), false, 5)
+	if !ok || vote.TargetID != "@jane:matrix.org" || vote.Reason != "<b>that</b>" {
+		t.Errorf("t5 failure: %v", vote)
+	}
+
+	////// t6
+	args, _ := ParseCommand("@banana-bot:matrix.org", "!", "!karma jane doe 7d", PlainMentionsToHTML("!karma jane doe 7d", names))
+	if userID, _ := args.Target(); userID != "@jane-doe:matrix.org" || args.Window().Since == 0 {
+		t.Errorf("t6 failure: %v", args)
+	}
+
+	////// t7
+	votes = u.FindVotes(PlainMentionsToHTML("thanks @alice:example.org.", nil), 5)
+	if len(votes) != 1 || votes[0].TargetID != "@alice:example.org" {
+		t.Errorf("t7 failure: %v", votes)
+	}
+
+	////// t8
+	vote, ok = d.FindVote(PlainMentionsToHTML("@alice:example.org-- for breaking ci", nil), false, 5)
+	if !ok || vote.TargetID != "@alice:example.org" || vote.Reason != "breaking ci" {
+		t.Errorf("t8 failure: %v", vote)
+	}
+}
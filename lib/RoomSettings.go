@@ -0,0 +1,418 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const DefaultCommandPrefix = "!"
+
+// longest command prefix a room may configure
+const MaxCommandPrefixLength = 4
+
+// handlers that are not message handlers but can still be turned off per room
+var extraHandlerNames = []string{"reactions"}
+
+type RoomSetting struct {
+	Name string
+	Help string
+	// value used by rooms that did not override the setting
+	Default func(kConf *KarmaConfig, roomID string) string
+	// validates a value given to !config set and returns its canonical form
+	Normalize func(value string) (string, error)
+}
+
+var RoomSettings = []RoomSetting{
+	{
+		"prefix", "character that starts a command",
+		func(kConf *KarmaConfig, roomID string) string { return DefaultCommandPrefix },
+		normalizePrefix,
+	},
+	{
+		"response-freq", "minimum time between two bot replies, e.g. 5s or 1m",
+		func(kConf *KarmaConfig, roomID string) string {
+			return (time.Duration(kConf.ResponseFreq) * time.Microsecond).String()
+		},
+		normalizeDuration,
+	},
+	{
+		"throttle-feedback", "react, queue or none, what happens to commands sent too often",
+		func(kConf *KarmaConfig, roomID string) string { return kConf.ThrottleFeedback },
+		normalizeThrottleFeedback,
+	},
+	{
+		"throttle-emoji", "reaction added to throttled commands",
+		func(kConf *KarmaConfig, roomID string) string { return kConf.ThrottleEmoji },
+		normalizeEmoji,
+	},
+	{
+		"positive-emojis", "comma separated reactions that give karma",
+		func(kConf *KarmaConfig, roomID string) string { return kConf.PositiveEmojis },
+		normalizeEmojis,
+	},
+	{
+		"negative-emojis", "comma separated reactions that take karma",
+		func(kConf *KarmaConfig, roomID string) string { return kConf.NegativeEmojis },
+		normalizeEmojis,
+	},
+	{
+		"reactions", "comma separated emoji:weight pairs, e.g. 💯:2,👎:-1",
+		func(kConf *KarmaConfig, roomID string) string { return kConf.Reactions },
+		normalizeReactions,
+	},
+	{
+		"negative-karma", "whether karma can be taken away at all",
+		func(kConf *KarmaConfig, roomID string) string { return "on" },
+		normalizeBool,
+	},
+	{
+		"negative-text", "whether @user-- messages take karma",
+		func(kConf *KarmaConfig, roomID string) string {
+			return boolSetting(!containsString(kConf.NoNegativeText, roomID))
+		},
+		normalizeBool,
+	},
+	{
+		"cascade-redactions", "whether redacting a message removes the reaction karma it got",
+		func(kConf *KarmaConfig, roomID string) string {
+			return boolSetting(!containsString(kConf.KeepRedactedKarma, roomID))
+		},
+		normalizeBool,
+	},
+	{
+		"one-reaction-vote", "whether reacting several times to a message only counts once",
+		func(kConf *KarmaConfig, roomID string) string { return boolSetting(kConf.OneReactionVote) },
+		normalizeBool,
+	},
+	{
+		"max-votes-per-target", "votes a user can give another user per vote-limit-window, 0 for no limit",
+		func(kConf *KarmaConfig, roomID string) string { return strconv.Itoa(kConf.MaxVotesPerTarget) },
+		normalizeCount,
+	},
+	{
+		"vote-limit-window", "time over which repeated votes are limited, e.g. 24h",
+		func(kConf *KarmaConfig, roomID string) string { return kConf.VoteLimitWindow.String() },
+		normalizePositiveDuration,
+	},
+	{
+		"diminishing-votes", "whether repeatedly thanking a user within vote-limit-window counts less",
+		func(kConf *KarmaConfig, roomID string) string { return boolSetting(kConf.DiminishingVotes) },
+		normalizeBool,
+	},
+	{
+		"handlers", "comma separated handlers that give karma, or none",
+		func(kConf *KarmaConfig, roomID string) string { return strings.Join(KarmaHandlerNames(), ",") },
+		normalizeHandlers,
+	},
+}
+
+func FindRoomSetting(name string) (RoomSetting, bool) {
+	name = strings.ToLower(name)
+	for _, setting := range RoomSettings {
+		if setting.Name == name {
+			return setting, true
+		}
+	}
+	return RoomSetting{}, false
+}
+
+// names accepted by the handlers setting
+func KarmaHandlerNames() []string {
+	names := []string{}
+	for _, handler := range KarmaMessageHandlers {
+		names = append(names, handler.Name())
+	}
+	return append(names, extraHandlerNames...)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func boolSetting(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func normalizeBool(value string) (string, error) {
+	switch strings.ToLower(value) {
+	case "on", "true", "yes", "1":
+		return "on", nil
+	case "off", "false", "no", "0":
+		return "off", nil
+	}
+	return "", fmt.Errorf("expected on or off, got %q", value)
+}
+
+func normalizeDuration(value string) (string, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return "", fmt.Errorf("expected a duration such as 5s or 1m, got %q", value)
+	}
+	return d.String(), nil
+}
+
+func normalizePositiveDuration(value string) (string, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return "", fmt.Errorf("expected a duration such as 12h or 30m, got %q", value)
+	}
+	return d.String(), nil
+}
+
+func normalizeCount(value string) (string, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("expected a number that is 0 or more, got %q", value)
+	}
+	return strconv.Itoa(n), nil
+}
+
+func normalizePrefix(value string) (string, error) {
+	if value == "" || utf8.RuneCountInString(value) > MaxCommandPrefixLength {
+		return "", fmt.Errorf("prefix must be between 1 and %d characters", MaxCommandPrefixLength)
+	}
+	for _, r := range value {
+		if unicode.IsSpace(r) || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return "", fmt.Errorf("prefix can not contain letters, digits or spaces")
+		}
+	}
+	return value, nil
+}
+
+func normalizeEmoji(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.ContainsAny(value, ", ") {
+		return "", fmt.Errorf("expected a single emoji, got %q", value)
+	}
+	return value, nil
+}
+
+func normalizeEmojis(value string) (string, error) {
+	emojis := []string{}
+	for _, emoji := range strings.Split(value, ",") {
+		emoji = strings.TrimSpace(emoji)
+		if emoji != "" {
+			emojis = append(emojis, emoji)
+		}
+	}
+	return strings.Join(emojis, ","), nil
+}
+
+func normalizeReactions(value string) (string, error) {
+	weights, err := ParseReactionWeights(value)
+	if err != nil {
+		return "", err
+	}
+	pairs := []string{}
+	for emoji, weight := range weights {
+		pairs = append(pairs, fmt.Sprintf("%s:%d", emoji, weight))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ","), nil
+}
+
+func normalizeHandlers(value string) (string, error) {
+	if strings.ToLower(value) == "none" {
+		return "", nil
+	}
+	known := KarmaHandlerNames()
+	names := []string{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || containsString(names, name) {
+			continue
+		}
+		if !containsString(known, name) {
+			return "", fmt.Errorf("unknown handler %q, expected some of %s", name, strings.Join(known, ", "))
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ","), nil
+}
+
+type RoomSettingsCache struct {
+	lock  sync.Mutex
+	rooms map[string]map[string]string
+}
+
+func NewRoomSettingsCache() *RoomSettingsCache {
+	return &RoomSettingsCache{rooms: map[string]map[string]string{}}
+}
+
+func (c *RoomSettingsCache) Invalidate(roomID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.rooms, roomID)
+}
+
+// settings overridden in roomID, read from the database once and cached
+func (kBot *KarmaBot) roomOverrides(roomID string) map[string]string {
+	c := kBot.settings
+	c.lock.Lock()
+	overrides, ok := c.rooms[roomID]
+	c.lock.Unlock()
+	if ok {
+		return overrides
+	}
+
+	overrides = map[string]string{}
+	query := `SELECT setting, value FROM room_settings WHERE roomID = ?`
+	rows, err := kBot.sqlDB.DB.Query(query, roomID)
+	if err != nil {
+		kBot.logger.Warnf("Error in roomOverrides for room %q: %v", roomID, err)
+		return overrides
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			kBot.logger.Warnf("Error while scanning settings of room %q: %v", roomID, err)
+			return overrides
+		}
+		overrides[name] = value
+	}
+	c.lock.Lock()
+	c.rooms[roomID] = overrides
+	c.lock.Unlock()
+	return overrides
+}
+
+// value of a setting in roomID and whether the room overrides the config file
+func (kBot *KarmaBot) GetRoomSetting(roomID, name string) (string, bool) {
+	if value, ok := kBot.roomOverrides(roomID)[name]; ok {
+		return value, true
+	}
+	setting, ok := FindRoomSetting(name)
+	if !ok {
+		return "", false
+	}
+	return setting.Default(kBot.kConf, roomID), false
+}
+
+func (kBot *KarmaBot) SetRoomSetting(roomID, name, value string) error {
+	defer kBot.settings.Invalidate(roomID)
+	tx, err := kBot.sqlDB.DB.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM room_settings WHERE roomID = ? AND setting = ?`, roomID, name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO room_settings (roomID, setting, value) VALUES (?, ?, ?)`, roomID, name, value)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (kBot *KarmaBot) ResetRoomSetting(roomID, name string) error {
+	defer kBot.settings.Invalidate(roomID)
+	_, err := kBot.sqlDB.DB.Exec(`DELETE FROM room_settings WHERE roomID = ? AND setting = ?`, roomID, name)
+	return err
+}
+
+func (kBot *KarmaBot) roomBool(roomID, name string) bool {
+	value, _ := kBot.GetRoomSetting(roomID, name)
+	return value == "on"
+}
+
+func (kBot *KarmaBot) roomInt(roomID, name string) int {
+	value, _ := kBot.GetRoomSetting(roomID, name)
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		kBot.logger.Warnf("Invalid %s %q in room %q: %v", name, value, roomID, err)
+	}
+	return n
+}
+
+func (kBot *KarmaBot) roomDuration(roomID, name string) time.Duration {
+	value, _ := kBot.GetRoomSetting(roomID, name)
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		kBot.logger.Warnf("Invalid %s %q in room %q: %v", name, value, roomID, err)
+	}
+	return d
+}
+
+func (kBot *KarmaBot) roomList(roomID, name string) []string {
+	value, _ := kBot.GetRoomSetting(roomID, name)
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+func (kBot *KarmaBot) CommandPrefix(roomID string) string {
+	value, _ := kBot.GetRoomSetting(roomID, "prefix")
+	return value
+}
+
+// minimum number of microseconds between two replies in roomID
+func (kBot *KarmaBot) ResponseFreq(roomID string) int64 {
+	value, _ := kBot.GetRoomSetting(roomID, "response-freq")
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		kBot.logger.Warnf("Invalid response-freq %q in room %q: %v", value, roomID, err)
+		return kBot.kConf.ResponseFreq
+	}
+	return d.Microseconds()
+}
+
+func (kBot *KarmaBot) PositiveEmojis(roomID string) []string {
+	return kBot.roomList(roomID, "positive-emojis")
+}
+
+// empty when negative karma is turned off in roomID
+func (kBot *KarmaBot) NegativeEmojis(roomID string) []string {
+	if !kBot.roomBool(roomID, "negative-karma") {
+		return []string{}
+	}
+	return kBot.roomList(roomID, "negative-emojis")
+}
+
+func (kBot *KarmaBot) HandlerEnabled(roomID, name string) bool {
+	return containsString(kBot.roomList(roomID, "handlers"), name)
+}
+
+// whether "@user--" style messages remove karma in roomID
+func (kBot *KarmaBot) NegativeTextVotes(roomID string) bool {
+	return kBot.roomBool(roomID, "negative-karma") && kBot.roomBool(roomID, "negative-text")
+}
+
+// whether redacting a message also removes the reaction votes it collected
+func (kBot *KarmaBot) CascadeRedactions(roomID string) bool {
+	return kBot.roomBool(roomID, "cascade-redactions")
+}
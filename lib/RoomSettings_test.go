@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"testing"
+)
+
+func TestRoomSettings(t *testing.T) {
+	kBot := newTestKarmaBot(t)
+	kBot.kConf = &KarmaConfig{
+		ResponseFreq:   5000000,
+		PositiveEmojis: "👍️,💯",
+		NegativeEmojis: "👎️",
+		NoNegativeText: []string{"quiet-room-matrix.org"},
+	}
+	roomA := "some-cool-room-matrix.org"
+	roomB := "quiet-room-matrix.org"
+
+	////// t1 defaults come from the config file
+	if kBot.CommandPrefix(roomA) != "!" || kBot.ResponseFreq(roomA) != 5000000 {
+		t.Errorf("t1.1 failure: %q %d", kBot.CommandPrefix(roomA), kBot.ResponseFreq(roomA))
+	}
+	if !kBot.NegativeTextVotes(roomA) || kBot.NegativeTextVotes(roomB) {
+		t.Errorf("t1.2 failure")
+	}
+	if !kBot.HandlerEnabled(roomA, "reactions") || !kBot.HandlerEnabled(roomA, "decrement") {
+		t.Errorf("t1.3 failure")
+	}
+
+	////// t2 overrides only apply to their room
+	if err := kBot.SetRoomSetting(roomA, "prefix", "?"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kBot.SetRoomSetting(roomA, "response-freq", "1m0s"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kBot.SetRoomSetting(roomA, "negative-karma", "off"); err != nil {
+		t.Fatal(err)
+	}
+	if kBot.CommandPrefix(roomA) != "?" || kBot.CommandPrefix(roomB) != "!" {
+		t.Errorf("t2.1 failure: %q %q", kBot.CommandPrefix(roomA), kBot.CommandPrefix(roomB))
+	}
+	if kBot.ResponseFreq(roomA) != 60000000 {
+		t.Errorf("t2.2 failure: %d", kBot.ResponseFreq(roomA))
+	}
+	if kBot.NegativeTextVotes(roomA) || len(kBot.NegativeEmojis(roomA)) != 0 || len(kBot.NegativeEmojis(roomB)) != 1 {
+		t.Errorf("t2.3 failure: %v", kBot.NegativeEmojis(roomA))
+	}
+	if _, overridden := kBot.GetRoomSetting(roomA, "prefix"); !overridden {
+		t.Errorf("t2.4 failure")
+	}
+
+	////// t3 set replaces the previous value, reset restores the default
+	if err := kBot.SetRoomSetting(roomA, "prefix", "."); err != nil {
+		t.Fatal(err)
+	}
+	if kBot.CommandPrefix(roomA) != "." {
+		t.Errorf("t3.1 failure: %q", kBot.CommandPrefix(roomA))
+	}
+	if err := kBot.ResetRoomSetting(roomA, "prefix"); err != nil {
+		t.Fatal(err)
+	}
+	if value, overridden := kBot.GetRoomSetting(roomA, "prefix"); value != "!" || overridden {
+		t.Errorf("t3.2 failure: %q", value)
+	}
+
+	////// t4 handlers
+	if err := kBot.SetRoomSetting(roomA, "handlers", "thanks,reactions"); err != nil {
+		t.Fatal(err)
+	}
+	if !kBot.HandlerEnabled(roomA, "thanks") || kBot.HandlerEnabled(roomA, "decrement") {
+		t.Errorf("t4 failure")
+	}
+}
+
+func TestRoomSettingValues(t *testing.T) {
+	cases := []struct {
+		name, value, want string
+		ok                bool
+	}{
+		{"prefix", "?", "?", true},
+		{"prefix", "k", "", false},
+		{"prefix", "!!!!!", "", false},
+		{"response-freq", "90s", "1m30s", true},
+		{"response-freq", "-1s", "", false},
+		{"negative-karma", "No", "off", true},
+		{"negative-karma", "maybe", "", false},
+		{"positive-emojis", "👍️, 💯,,", "👍️,💯", true},
+		{"handlers", "Thanks, reactions, thanks", "thanks,reactions", true},
+		{"handlers", "none", "", true},
+		{"handlers", "thanks,bananas", "", false},
+	}
+	for i, c := range cases {
+		setting, ok := FindRoomSetting(c.name)
+		if !ok {
+			t.Fatalf("t%d failure: unknown setting %q", i+1, c.name)
+		}
+		value, err := setting.Normalize(c.value)
+		if (err == nil) != c.ok || value != c.want {
+			t.Errorf("t%d failure: %q -> %q, %v", i+1, c.value, value, err)
+		}
+	}
+}
+
+func TestReactionVote(t *testing.T) {
+	kBot := newTestKarmaBot(t)
+	kBot.kConf = &KarmaConfig{
+		PositiveEmojis: "👍️,💯,🍌",
+		NegativeEmojis: "👎️",
+		Reactions:      "💯:2,🍌:1,🙁:-1",
+	}
+	roomA := "some-cool-room-matrix.org"
+
+	////// t1 weights take precedence, the emoji lists count as ±1
+	cases := map[string]int64{"💯": 2, "🍌": 1, "👍️": 1, "👎️": -1, "🙁": -1}
+	for emoji, want := range cases {
+		if vote, ok := kBot.ReactionVote(roomA, emoji); !ok || vote != want {
+			t.Errorf("t1 failure: %s %d", emoji, vote)
+		}
+	}
+	if _, ok := kBot.ReactionVote(roomA, "🐈"); ok {
+		t.Errorf("t1 failure: 🐈")
+	}
+
+	////// t2 negative weights follow negative-karma
+	if err := kBot.SetRoomSetting(roomA, "negative-karma", "off"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := kBot.ReactionVote(roomA, "🙁"); ok {
+		t.Errorf("t2.1 failure")
+	}
+	if vote, _ := kBot.ReactionVote(roomA, "💯"); vote != 2 {
+		t.Errorf("t2.2 failure: %d", vote)
+	}
+
+	////// t3 parsing
+	if _, err := ParseReactionWeights("💯:2,👍"); err == nil {
+		t.Errorf("t3.1 failure")
+	}
+	if _, err := ParseReactionWeights("💯:0"); err == nil {
+		t.Errorf("t3.2 failure")
+	}
+	if weights, err := ParseReactionWeights(" 💯 : 2 ,:party:: 3,"); err != nil || weights["💯"] != 2 || weights[":party:"] != 3 {
+		t.Errorf("t3.3 failure: %v %v", weights, err)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"database/sql"
+)
+
+// allow a single message to hold votes for several targets
+func SQLPatchv_1_3_0_(db *sql.DB, dbType string) error {
+	var queries []string
+	switch dbType {
+	case "sqlite3":
+		queries = []string{
+			"CREATE TABLE events_v1_3_0 (senderID VARCHAR(1000) NOT NULL, targetID VARCHAR(1000) NOT NULL, eventID VARCHAR(375), roomID VARCHAR(375), vote INTEGER NOT NULL, origin_server_ts BIGINT NOT NULL DEFAULT 0, reason VARCHAR(1000) NOT NULL DEFAULT '', PRIMARY KEY(eventID, roomID, targetID));",
+			"INSERT INTO events_v1_3_0 (senderID, targetID, eventID, roomID, vote, origin_server_ts, reason) SELECT senderID, targetID, eventID, roomID, vote, origin_server_ts, reason FROM events;",
+			"DROP TABLE events;",
+			"ALTER TABLE events_v1_3_0 RENAME TO events;",
+		}
+	case "mysql":
+		// key prefixes keep the index below the 3072 byte limit of InnoDB
+		queries = []string{
+			"ALTER TABLE events DROP PRIMARY KEY, ADD PRIMARY KEY(eventID(250), roomID(250), targetID(250));",
+		}
+	default:
+		queries = []string{
+			"ALTER TABLE events DROP CONSTRAINT events_pkey;",
+			"ALTER TABLE events ADD PRIMARY KEY(eventID, roomID, targetID);",
+		}
+	}
+	queries = append(queries, "UPDATE version SET major = 1, minor = 3, patch = 0;")
+	for _, query := range queries {
+		_, err := db.Exec(query)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var SQLPatchv_1_3_0 = BotVersion{1, 3, 0, SQLPatchv_1_3_0_}
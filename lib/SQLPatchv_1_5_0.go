@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"database/sql"
+)
+
+// settings that rooms override instead of using the config file
+func SQLPatchv_1_5_0_(db *sql.DB, dbType string) error {
+	queries := []string{
+		"CREATE TABLE room_settings (roomID VARCHAR(375) NOT NULL, setting VARCHAR(64) NOT NULL, value VARCHAR(1000) NOT NULL, PRIMARY KEY(roomID, setting));",
+		"UPDATE version SET major = 1, minor = 5, patch = 0;",
+	}
+	for _, query := range queries {
+		_, err := db.Exec(query)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var SQLPatchv_1_5_0 = BotVersion{1, 5, 0, SQLPatchv_1_5_0_}
@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"database/sql"
+)
+
+// record of the changes made by moderators
+func SQLPatchv_1_6_0_(db *sql.DB, dbType string) error {
+	queries := []string{
+		"CREATE TABLE audit_log (roomID VARCHAR(375) NOT NULL, actorID VARCHAR(375) NOT NULL, action VARCHAR(64) NOT NULL, arguments VARCHAR(1000) NOT NULL, origin_server_ts BIGINT NOT NULL);",
+		"CREATE INDEX audit_log_room ON audit_log (roomID, origin_server_ts);",
+		"UPDATE version SET major = 1, minor = 6, patch = 0;",
+	}
+	for _, query := range queries {
+		_, err := db.Exec(query)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var SQLPatchv_1_6_0 = BotVersion{1, 6, 0, SQLPatchv_1_6_0_}
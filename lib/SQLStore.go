@@ -86,4 +86,4 @@ func (s *SQLStore) UpdateDB(dbPatches BotVersionArr) error {
 	return nil
 }
 
-var SQLKarmaPatches = []BotVersion{SQLPatchv_1_0_0}
+var SQLKarmaPatches = []BotVersion{SQLPatchv_1_0_0, SQLPatchv_1_1_0, SQLPatchv_1_2_0, SQLPatchv_1_3_0, SQLPatchv_1_4_0, SQLPatchv_1_5_0, SQLPatchv_1_6_0}
@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"maunium.net/go/mautrix"
+)
+
+type SyncState int
+
+const (
+	SyncStarting SyncState = iota
+	SyncConnected
+	SyncReconnecting
+	SyncStopped
+	SyncFailed
+)
+
+func (s SyncState) String() string {
+	switch s {
+	case SyncStarting:
+		return "starting"
+	case SyncConnected:
+		return "connected"
+	case SyncReconnecting:
+		return "reconnecting"
+	case SyncStopped:
+		return "stopped"
+	case SyncFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+type SyncStatus struct {
+	State     SyncState
+	Since     time.Time // when State was entered
+	LastSync  time.Time // last successful sync, zero before the first one
+	Failures  int       // failed syncs since the last successful one
+	LastError string
+}
+
+// errors retrying can not fix, the access token has to be replaced
+var fatalSyncErrors = []error{mautrix.MUnknownToken, mautrix.MMissingToken, mautrix.MUserDeactivated}
+
+func IsFatalSyncError(err error) bool {
+	for _, fatal := range fatalSyncErrors {
+		if errors.Is(err, fatal) {
+			return true
+		}
+	}
+	return false
+}
+
+// exponential backoff after the given number of consecutive failures, capped
+// at max, jitter in [0, 1) picks a delay in the upper half of the interval
+func BackoffDelay(min, max time.Duration, failures int, jitter float64) time.Duration {
+	delay := min
+	for i := 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay/2 + time.Duration(jitter*float64(delay/2))
+}
+
+// keeps the bot syncing through homeserver outages, transient errors are
+// retried with a jittered exponential backoff and fatal ones stop the bot
+type SyncSupervisor struct {
+	*mautrix.DefaultSyncer
+	logger     *BotLogger
+	backoffMin time.Duration
+	backoffMax time.Duration
+	lock       sync.Mutex
+	status     SyncStatus
+	cancel     context.CancelFunc
+	stopped    bool
+}
+
+func NewSyncSupervisor(backoffMin, backoffMax time.Duration, logger *BotLogger) *SyncSupervisor {
+	return &SyncSupervisor{
+		DefaultSyncer: mautrix.NewDefaultSyncer(),
+		logger:        logger,
+		backoffMin:    backoffMin,
+		backoffMax:    backoffMax,
+		status:        SyncStatus{State: SyncStarting, Since: time.Now()},
+	}
+}
+
+func (s *SyncSupervisor) Status() SyncStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.status
+}
+
+// must be called with s.lock held
+func (s *SyncSupervisor) setState(state SyncState, err error) {
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+	if s.status.State == state {
+		return
+	}
+	if err != nil {
+		s.logger.Warnf("Sync is %s, was %s: %v", state, s.status.State, err)
+	} else {
+		s.logger.Infof("Sync is %s, was %s", state, s.status.State)
+	}
+	s.status.State = state
+	s.status.Since = time.Now()
+}
+
+// records a failed sync and returns how long to wait before the next one
+func (s *SyncSupervisor) failed(err error) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.status.Failures++
+	s.setState(SyncReconnecting, err)
+	delay := BackoffDelay(s.backoffMin, s.backoffMax, s.status.Failures, rand.Float64())
+	s.logger.Warnf("Sync failed %d times in a row, retrying in %v: %v", s.status.Failures, delay, err)
+	return delay
+}
+
+// called by the client for errors of a running sync
+func (s *SyncSupervisor) OnFailedSync(res *mautrix.RespSync, err error) (time.Duration, error) {
+	if IsFatalSyncError(err) {
+		return 0, err
+	}
+	return s.failed(err), nil
+}
+
+func (s *SyncSupervisor) ProcessResponse(res *mautrix.RespSync, since string) error {
+	s.lock.Lock()
+	s.status.Failures = 0
+	s.status.LastSync = time.Now()
+	s.setState(SyncConnected, nil)
+	s.lock.Unlock()
+	return s.DefaultSyncer.ProcessResponse(res, since)
+}
+
+// syncs until Stop is called, ctx is done or a fatal error occurs
+func (s *SyncSupervisor) Run(ctx context.Context, client *mautrix.Client) error {
+	s.lock.Lock()
+	if s.stopped {
+		s.lock.Unlock()
+		return nil
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.lock.Unlock()
+	defer s.cancel()
+
+	for {
+		err := client.SyncWithContext(ctx)
+		s.lock.Lock()
+		if s.stopped || err == nil {
+			s.setState(SyncStopped, nil)
+			s.lock.Unlock()
+			return nil
+		}
+		if ctx.Err() != nil {
+			s.setState(SyncStopped, nil)
+			s.lock.Unlock()
+			return ctx.Err()
+		}
+		if IsFatalSyncError(err) {
+			s.setState(SyncFailed, err)
+			s.lock.Unlock()
+			return err
+		}
+		s.lock.Unlock()
+		// a cancelled ctx ends the next sync right away
+		select {
+		case <-ctx.Done():
+		case <-time.After(s.failed(err)):
+		}
+	}
+}
+
+// ends Run, also while it waits to retry
+func (s *SyncSupervisor) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stopped = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"maunium.net/go/mautrix"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	cases := []struct {
+		failures int
+		jitter   float64
+		delay    time.Duration
+	}{
+		{1, 0, time.Second},
+		{1, 0.5, 1500 * time.Millisecond},
+		{2, 0, 2 * time.Second},
+		{4, 0, 8 * time.Second},
+		{10, 0, 30 * time.Second},
+		{100, 0.99, 59700 * time.Millisecond},
+	}
+	for i, c := range cases {
+		if delay := BackoffDelay(2*time.Second, time.Minute, c.failures, c.jitter); delay != c.delay {
+			t.Errorf("t%d failure: %v", i+1, delay)
+		}
+	}
+}
+
+func TestSyncSupervisor(t *testing.T) {
+	s := NewSyncSupervisor(time.Second, time.Minute, NewBotLogger())
+	tokenErr := mautrix.HTTPError{RespError: &mautrix.RespError{ErrCode: "M_UNKNOWN_TOKEN", Err: "Invalid access token"}}
+
+	////// t1 fatal and transient errors
+	if !IsFatalSyncError(tokenErr) || !IsFatalSyncError(fmt.Errorf("sync: %w", tokenErr)) {
+		t.Errorf("t1.1 failure")
+	}
+	if IsFatalSyncError(errors.New("connection refused")) || IsFatalSyncError(mautrix.MLimitExceeded) {
+		t.Errorf("t1.2 failure")
+	}
+
+	////// t2 transient errors back off and are retried
+	for i := 1; i <= 3; i++ {
+		delay, err := s.OnFailedSync(nil, errors.New("connection refused"))
+		if err != nil || delay < 500*time.Millisecond || delay > time.Duration(1<<(i-1))*time.Second {
+			t.Errorf("t2.1 failure: %v %v", delay, err)
+		}
+	}
+	if status := s.Status(); status.State != SyncReconnecting || status.Failures != 3 || status.LastError != "connection refused" {
+		t.Errorf("t2.2 failure: %+v", status)
+	}
+	if _, err := s.OnFailedSync(nil, tokenErr); err == nil {
+		t.Errorf("t2.3 failure")
+	}
+
+	////// t3 a successful sync resets the failures
+	if err := s.ProcessResponse(&mautrix.RespSync{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if status := s.Status(); status.State != SyncConnected || status.Failures != 0 || status.LastSync.IsZero() {
+		t.Errorf("t3 failure: %+v", status)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	kBot := new(KarmaBot)
+	kBot.logger = NewBotLogger()
+	kBot.syncer = NewSyncSupervisor(time.Second, time.Minute, kBot.logger)
+	kBot.dispatch = NewDispatcher(1, 10, kBot.logger)
+	handler := kBot.HealthHandler()
+
+	check := func(code int, status string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var resp healthResponse
+		err := json.NewDecoder(rec.Body).Decode(&resp)
+		if err != nil || rec.Code != code || resp.Status != status {
+			t.Errorf("health failure: %d %+v %v", rec.Code, resp, err)
+		}
+	}
+	check(http.StatusServiceUnavailable, "starting")
+	kBot.syncer.ProcessResponse(&mautrix.RespSync{}, "")
+	check(http.StatusOK, "connected")
+	kBot.syncer.OnFailedSync(nil, errors.New("connection refused"))
+	check(http.StatusServiceUnavailable, "reconnecting")
+}
+
+func TestSyncSupervisorRun(t *testing.T) {
+	code, errcode := http.StatusBadGateway, "M_UNKNOWN"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+		fmt.Fprintf(w, `{"errcode": %q, "error": "test"}`, errcode)
+	}))
+	defer server.Close()
+	client, err := mautrix.NewClient(server.URL, "@bot:matrix.org", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	////// t1 transient errors are retried until Stop
+	s := NewSyncSupervisor(10*time.Millisecond, 20*time.Millisecond, NewBotLogger())
+	client.Syncer = s
+	done := make(chan error)
+	go func() { done <- s.Run(context.Background(), client) }()
+	time.Sleep(200 * time.Millisecond)
+	if status := s.Status(); status.State != SyncReconnecting || status.Failures < 2 {
+		t.Errorf("t1.1 failure: %+v", status)
+	}
+	s.Stop()
+	if err := <-done; err != nil || s.Status().State != SyncStopped {
+		t.Errorf("t1.2 failure: %v %+v", err, s.Status())
+	}
+
+	////// t2 an invalid access token stops the supervisor
+	code, errcode = http.StatusUnauthorized, "M_UNKNOWN_TOKEN"
+	s = NewSyncSupervisor(10*time.Millisecond, 20*time.Millisecond, NewBotLogger())
+	client.Syncer = s
+	if err := s.Run(context.Background(), client); !IsFatalSyncError(err) || s.Status().State != SyncFailed {
+		t.Errorf("t2 failure: %v %+v", err, s.Status())
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"maunium.net/go/mautrix/event"
+)
+
+// shortest wait before retrying a queued command, avoids spinning on
+// rounding errors of the token buckets
+const MinQueueDelay = 100 * time.Millisecond
+
+var throttleModes = []string{"react", "queue", "none"}
+
+func normalizeThrottleFeedback(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if !containsString(throttleModes, value) {
+		return "", fmt.Errorf("expected one of %s, got %q", strings.Join(throttleModes, ", "), value)
+	}
+	return value, nil
+}
+
+type queuedCommand struct {
+	ctx     context.Context
+	evt     *event.Event
+	command KarmaCommand
+	args    *KarmaArgs
+	timer   *time.Timer
+}
+
+// commands waiting for the rate limits to allow a reply, at most one per
+// room, command, sender and arguments
+type ReplyQueue struct {
+	lock    sync.Mutex
+	pending map[string]*queuedCommand
+	stopped bool
+}
+
+func NewReplyQueue() *ReplyQueue {
+	return &ReplyQueue{pending: map[string]*queuedCommand{}}
+}
+
+// lets the sender of a throttled command know it was not ignored
+func (kBot *KarmaBot) ThrottleCommand(ctx context.Context, evt *event.Event, command KarmaCommand, args *KarmaArgs) {
+	roomID := evt.RoomID.String()
+	mode, _ := kBot.GetRoomSetting(roomID, "throttle-feedback")
+	switch mode {
+	case "react":
+		emoji, _ := kBot.GetRoomSetting(roomID, "throttle-emoji")
+		_, err := kBot.mClient.SendReaction(evt.RoomID, evt.ID, emoji)
+		if err != nil {
+			kBot.logger.Warnf("Error while reacting to throttled command %s: %v", evt.ID, err)
+		}
+	case "queue":
+		kBot.queue.Enqueue(ctx, kBot, evt, command, args)
+	}
+}
+
+// only identical invocations share a queue entry, pills and case do not
+// make two invocations different
+func queueKey(evt *event.Event, command KarmaCommand, args *KarmaArgs) string {
+	key := []string{evt.RoomID.String(), command.Name(), evt.Sender.String()}
+	for i := range args.Args {
+		key = append(key, strings.ToLower(args.Args[i].Plain()))
+	}
+	return strings.Join(key, "\x00")
+}
+
+// queues a reply to evt, the same sender repeating the same command while it
+// waits is answered once, in reply to the most recent invocation
+func (q *ReplyQueue) Enqueue(ctx context.Context, kBot *KarmaBot, evt *event.Event, command KarmaCommand, args *KarmaArgs) {
+	key := queueKey(evt, command, args)
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.stopped {
+		return
+	}
+	if queued, ok := q.pending[key]; ok {
+		queued.ctx, queued.evt, queued.args = ctx, evt, args
+		return
+	}
+	queued := &queuedCommand{ctx: ctx, evt: evt, command: command, args: args}
+	q.pending[key] = queued
+	q.schedule(kBot, key, queued)
+}
+
+// must be called with q.lock held
+func (q *ReplyQueue) schedule(kBot *KarmaBot, key string, queued *queuedCommand) {
+	limits := kBot.ResponseLimits(queued.evt.RoomID.String(), queued.evt.Sender.String(), queued.command.Name())
+	delay := kBot.limiter.Delay(limits)
+	if delay < MinQueueDelay {
+		delay = MinQueueDelay
+	}
+	queued.timer = time.AfterFunc(delay, func() { q.fire(kBot, key) })
+}
+
+func (q *ReplyQueue) fire(kBot *KarmaBot, key string) {
+	q.lock.Lock()
+	queued, ok := q.pending[key]
+	if !ok || q.stopped {
+		q.lock.Unlock()
+		return
+	}
+	limits := kBot.ResponseLimits(queued.evt.RoomID.String(), queued.evt.Sender.String(), queued.command.Name())
+	if !kBot.limiter.Take(limits) {
+		q.schedule(kBot, key, queued)
+		q.lock.Unlock()
+		return
+	}
+	delete(q.pending, key)
+	q.lock.Unlock()
+	// the reply waits behind the events of the room and is drained on shutdown
+	run := func() { runCommand(queued.ctx, queued.evt, kBot, queued.command, queued.args, limits) }
+	if !kBot.dispatch.Submit(queued.evt.RoomID.String(), "queued "+queued.command.Name(), run) {
+		kBot.limiter.Refund(limits)
+	}
+}
+
+// number of commands waiting for a reply
+func (q *ReplyQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.pending)
+}
+
+// drops the queued commands, nothing is queued afterwards
+func (q *ReplyQueue) Stop() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.stopped = true
+	for key, queued := range q.pending {
+		queued.timer.Stop()
+		delete(q.pending, key)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+// records the arguments it was run with, after sleeping for delay
+type testCommand struct {
+	lock    sync.Mutex
+	senders []string
+	delay   time.Duration
+}
+
+func (u *testCommand) Name() string         { return "test" }
+func (u *testCommand) Aliases() []string    { return []string{} }
+func (u *testCommand) Summary() string      { return "" }
+func (u *testCommand) Args() []KarmaArgSpec { return []KarmaArgSpec{} }
+func (u *testCommand) NeedsTimer() bool     { return true }
+func (u *testCommand) PowerLevel() int      { return PowerUser }
+func (u *testCommand) Process(ctx context.Context, evt *event.Event, kBot *KarmaBot, args *KarmaArgs) bool {
+	time.Sleep(u.delay)
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.senders = append(u.senders, args.SenderID)
+	return true
+}
+
+func (u *testCommand) ran() []string {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return append([]string{}, u.senders...)
+}
+
+func TestReplyQueue(t *testing.T) {
+	ctx := context.Background()
+	kBot := newTestKarmaBot(t)
+	kBot.kConf = &KarmaConfig{ResponseFreq: (200 * time.Millisecond).Microseconds()}
+	kBot.limiter = NewRateLimiter()
+	kBot.queue = NewReplyQueue()
+	kBot.dispatch = NewDispatcher(1, 10, kBot.logger)
+	command := &testCommand{}
+	roomID := "!room:matrix.org"
+
+	////// t1 only identical invocations of a command are answered once
+	if !kBot.limiter.Take(kBot.ResponseLimits(roomID, "@a:matrix.org", command.Name())) {
+		t.Fatalf("t1.1 failure")
+	}
+	invocations := []struct{ sender, body string }{
+		{"@a:matrix.org", "!test @x:matrix.org"},
+		{"@a:matrix.org", "!test @X:matrix.org"},
+		{"@a:matrix.org", "!test @y:matrix.org"},
+		{"@b:matrix.org", "!test @x:matrix.org"},
+	}
+	for _, invocation := range invocations {
+		evt := &event.Event{RoomID: id.RoomID(roomID), Sender: id.UserID(invocation.sender)}
+		args, _ := ParseCommand(invocation.sender, "!", invocation.body, "")
+		kBot.queue.Enqueue(ctx, kBot, evt, command, args)
+	}
+	if kBot.queue.Len() != 3 || len(command.ran()) != 0 {
+		t.Errorf("t1.2 failure: %d", kBot.queue.Len())
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if ran := command.ran(); len(ran) != 3 || kBot.queue.Len() != 0 {
+		t.Errorf("t1.3 failure: %v", ran)
+	}
+
+	////// t2 nothing runs after Stop
+	kBot.limiter.Take(kBot.ResponseLimits(roomID, "@a:matrix.org", command.Name()))
+	evt := &event.Event{RoomID: id.RoomID(roomID), Sender: "@a:matrix.org"}
+	kBot.queue.Enqueue(ctx, kBot, evt, command, &KarmaArgs{SenderID: "@a:matrix.org", Prefix: "!"})
+	kBot.queue.Stop()
+	kBot.queue.Enqueue(ctx, kBot, evt, command, &KarmaArgs{SenderID: "@a:matrix.org", Prefix: "!"})
+	time.Sleep(time.Second)
+	if len(command.ran()) != 3 || kBot.queue.Len() != 0 {
+		t.Errorf("t2 failure")
+	}
+}
+
+// a queued command that already fired is drained by the dispatcher
+func TestReplyQueueShutdown(t *testing.T) {
+	ctx := context.Background()
+	kBot := newTestKarmaBot(t)
+	kBot.kConf = &KarmaConfig{ResponseFreq: (100 * time.Millisecond).Microseconds()}
+	kBot.limiter = NewRateLimiter()
+	kBot.queue = NewReplyQueue()
+	kBot.dispatch = NewDispatcher(1, 10, kBot.logger)
+	command := &testCommand{delay: 300 * time.Millisecond}
+	roomID := "!room:matrix.org"
+
+	kBot.limiter.Take(kBot.ResponseLimits(roomID, "@a:matrix.org", command.Name()))
+	evt := &event.Event{RoomID: id.RoomID(roomID), Sender: "@a:matrix.org"}
+	kBot.queue.Enqueue(ctx, kBot, evt, command, &KarmaArgs{SenderID: "@a:matrix.org", Prefix: "!"})
+	for kBot.queue.Len() != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	kBot.queue.Stop()
+	if !kBot.dispatch.Stop(ctx) || len(command.ran()) != 1 {
+		t.Errorf("t1 failure: %v", command.ran())
+	}
+}
@@ -24,7 +24,7 @@ import (
 	"fmt"
 	"math/rand"
 	"reflect"
-	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -90,14 +90,110 @@ func DecodeRoom(room []byte) (*mautrix.Room, error) {
 	return r, nil
 }
 
-var userRegexString = `\<a\s+href=".+/(.+)">.+</a>`
-var urxp = regexp.MustCompile(userRegexString)
+type KarmaWindow struct {
+	Since int64 // unix timestamp in milliseconds, 0 for all time
+	Desc  string
+}
+
+var windowUnits = map[byte]time.Duration{
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// accepts durations such as 12h, 7d, 2w and dates of the form since:2006-01-02
+func ParseKarmaWindow(arg string, now time.Time) (KarmaWindow, bool) {
+	arg = strings.ToLower(strings.TrimSpace(arg))
+	if strings.HasPrefix(arg, "since:") {
+		date := strings.TrimPrefix(arg, "since:")
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return KarmaWindow{}, false
+		}
+		return KarmaWindow{t.UnixMilli(), "since " + date}, true
+	}
+	if len(arg) < 2 {
+		return KarmaWindow{}, false
+	}
+	unit, ok := windowUnits[arg[len(arg)-1]]
+	if !ok {
+		return KarmaWindow{}, false
+	}
+	n, err := strconv.ParseInt(arg[:len(arg)-1], 10, 64)
+	if err != nil || n < 1 {
+		return KarmaWindow{}, false
+	}
+	since := now.Add(-time.Duration(n) * unit)
+	return KarmaWindow{since.UnixMilli(), "in the last " + arg}, true
+}
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+// unicode bar chart of values scaled between their minimum and maximum
+func Sparkline(values []int64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+	}
+	spark := make([]rune, len(values))
+	for i, v := range values {
+		level := 0
+		if hi > lo {
+			level = int((v - lo) * int64(len(sparkChars)-1) / (hi - lo))
+		}
+		spark[i] = sparkChars[level]
+	}
+	return string(spark)
+}
+
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\", "`", "\\`", "*", "\\*", "_", "\\_", "{", "\\{", "}", "\\}",
+	"[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)", "#", "\\#", "+", "\\+",
+	"-", "\\-", ".", "\\.", "!", "\\!", "|", "\\|", "<", "\\<", ">", "\\>", "~", "\\~",
+)
+
+// escapes user supplied text before it is rendered with format.RenderMarkdown
+func EscapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
 
-func HTMLToUserID(href string) string {
-	thref := strings.TrimSpace(href)
-	if urxp.MatchString(thref) {
-		userID := urxp.ReplaceAllString(thref, "$1")
-		return userID
+func UserPill(userID string) string {
+	return fmt.Sprintf("[%s](https://matrix.to/#/%s)", userID, userID)
+}
+
+// levenshtein distance between a and b
+func EditDistance(a, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev, curr = curr, prev
 	}
-	return ""
+	return prev[len(rb)]
 }
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseKarmaWindow(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	////// t1
+	w, ok := ParseKarmaWindow("7d", now)
+	if !ok || w.Since != now.Add(-7*24*time.Hour).UnixMilli() {
+		t.Errorf("t1 failure: %v", w)
+	}
+
+	////// t2
+	w, ok = ParseKarmaWindow("2W", now)
+	if !ok || w.Since != now.Add(-14*24*time.Hour).UnixMilli() {
+		t.Errorf("t2 failure: %v", w)
+	}
+
+	////// t3
+	w, ok = ParseKarmaWindow("since:2026-01-01", now)
+	if !ok || w.Since != time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli() {
+		t.Errorf("t3 failure: %v", w)
+	}
+
+	////// t4
+	for _, arg := range []string{"", "d", "0d", "-3d", "7y", "5", "since:yesterday"} {
+		if _, ok := ParseKarmaWindow(arg, now); ok {
+			t.Errorf("t4 failure: %q", arg)
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	////// t1
+	if Sparkline([]int64{0, 1, 2, 3, 4, 5, 6, 7}) != "▁▂▃▄▅▆▇█" {
+		t.Errorf("t1 failure: %q", Sparkline([]int64{0, 1, 2, 3, 4, 5, 6, 7}))
+	}
+
+	////// t2
+	if Sparkline([]int64{-2, 0, 2}) != "▁▄█" {
+		t.Errorf("t2 failure: %q", Sparkline([]int64{-2, 0, 2}))
+	}
+
+	////// t3
+	if Sparkline([]int64{3, 3}) != "▁▁" || Sparkline(nil) != "" {
+		t.Errorf("t3 failure")
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		d    int
+	}{
+		{"", "", 0},
+		{"karma", "karma", 0},
+		{"karm", "karma", 1},
+		{"kamra", "karma", 2},
+		{"tkarma", "karma", 1},
+		{"", "top", 3},
+		{"❤️", "❤", 1},
+	}
+	for i, c := range cases {
+		if d := EditDistance(c.a, c.b); d != c.d {
+			t.Errorf("t%d failure: EditDistance(%q, %q) = %d", i+1, c.a, c.b, d)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+)
+
+type KarmaVote struct {
+	SenderID  string
+	TargetID  string
+	EventID   string
+	RoomID    string
+	RelatesTo string // message a reaction was given to, empty for text votes
+	Vote      int64
+	Timestamp int64 // unix timestamp in milliseconds
+	Reason    string
+}
+
+// rules checked before a vote is recorded, Apply rejects a vote by returning
+// false and may also lower its weight
+type VotePolicy interface {
+	Name() string
+	Enabled(kBot *KarmaBot, roomID string) bool
+	Apply(ctx context.Context, kBot *KarmaBot, vote *KarmaVote) bool
+}
+
+var VotePolicies = []VotePolicy{
+	&VotePolicy_OneReaction{},
+	&VotePolicy_Limit{},
+	&VotePolicy_Diminishing{},
+}
+
+// records a vote given by reacting or messaging once the enabled policies of
+// the room allowed it, moderators adjusting karma use KarmaAdd directly
+func (kBot *KarmaBot) CastVote(ctx context.Context, senderID, targetID, eventID, roomID, relatesTo string, vote, timestamp int64, reason string) bool {
+	kVote := &KarmaVote{senderID, targetID, eventID, roomID, relatesTo, vote, timestamp, reason}
+	for _, policy := range VotePolicies {
+		if policy.Enabled(kBot, roomID) && !policy.Apply(ctx, kBot, kVote) {
+			kBot.logger.Debugf("Vote of %s for %s in room %s rejected by %s", senderID, targetID, roomID, policy.Name())
+			return false
+		}
+	}
+	kBot.KarmaAdd(ctx, kVote.SenderID, kVote.TargetID, kVote.EventID, kVote.RoomID, kVote.RelatesTo, kVote.Vote, kVote.Timestamp, kVote.Reason)
+	return true
+}
+
+// start of the vote-limit-window of roomID ending at timestamp, in milliseconds
+func (kBot *KarmaBot) voteWindowStart(roomID string, timestamp int64) int64 {
+	return timestamp - kBot.roomDuration(roomID, "vote-limit-window").Milliseconds()
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+)
+
+type VotePolicy_Diminishing struct {
+}
+
+func (u *VotePolicy_Diminishing) Name() string {
+	return "diminishing-votes"
+}
+
+func (u *VotePolicy_Diminishing) Enabled(kBot *KarmaBot, roomID string) bool {
+	return kBot.roomBool(roomID, "diminishing-votes")
+}
+
+// only the 1st, 2nd, 4th, 8th, ... thanks to the same user within the window
+// give karma, the others are recorded with a weight of 0 so that they are
+// still counted towards the next one
+func (u *VotePolicy_Diminishing) Apply(ctx context.Context, kBot *KarmaBot, vote *KarmaVote) bool {
+	if vote.RelatesTo != "" || vote.Vote <= 0 {
+		return true
+	}
+	since := kBot.voteWindowStart(vote.RoomID, vote.Timestamp)
+	n := kBot.CountThanksBetween(ctx, vote.SenderID, vote.TargetID, vote.RoomID, since, vote.Timestamp) + 1
+	if n&(n-1) != 0 {
+		vote.Vote = 0
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+)
+
+type VotePolicy_Limit struct {
+}
+
+func (u *VotePolicy_Limit) Name() string {
+	return "max-votes-per-target"
+}
+
+func (u *VotePolicy_Limit) Enabled(kBot *KarmaBot, roomID string) bool {
+	return kBot.roomInt(roomID, "max-votes-per-target") > 0
+}
+
+func (u *VotePolicy_Limit) Apply(ctx context.Context, kBot *KarmaBot, vote *KarmaVote) bool {
+	since := kBot.voteWindowStart(vote.RoomID, vote.Timestamp)
+	count := kBot.CountVotesBetween(ctx, vote.SenderID, vote.TargetID, vote.RoomID, since, vote.Timestamp)
+	return count < int64(kBot.roomInt(vote.RoomID, "max-votes-per-target"))
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+)
+
+type VotePolicy_OneReaction struct {
+}
+
+func (u *VotePolicy_OneReaction) Name() string {
+	return "one-reaction-vote"
+}
+
+func (u *VotePolicy_OneReaction) Enabled(kBot *KarmaBot, roomID string) bool {
+	return kBot.roomBool(roomID, "one-reaction-vote")
+}
+
+// a second reaction to the same message does not count, removing the
+// first one lets the sender react again
+func (u *VotePolicy_OneReaction) Apply(ctx context.Context, kBot *KarmaBot, vote *KarmaVote) bool {
+	if vote.RelatesTo == "" {
+		return true
+	}
+	return kBot.CountReactionVotes(ctx, vote.SenderID, vote.RelatesTo, vote.RoomID) == 0
+}
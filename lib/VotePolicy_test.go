@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2022 Aisha Tammy <aisha@bsd.ac>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ *
+ */
+package lib
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVotePolicies(t *testing.T) {
+	ctx := context.Background()
+	kBot := newTestKarmaBot(t)
+	kBot.kConf = &KarmaConfig{
+		OneReactionVote: true,
+		VoteLimitWindow: time.Hour,
+	}
+	userA := "@banana-bot:matrix.org"
+	userB := "@jane-doe:matrix.org"
+	roomA := "some-cool-room-matrix.org"
+	roomB := "other-cool-room-matrix.org"
+	hour := time.Hour.Milliseconds()
+
+	////// t1 one reaction vote per message
+	if !kBot.CastVote(ctx, userA, userB, "reaction-1", roomA, "message-1", 1, hour, "") {
+		t.Errorf("t1.1 failure")
+	}
+	if kBot.CastVote(ctx, userA, userB, "reaction-2", roomA, "message-1", 1, hour, "") {
+		t.Errorf("t1.2 failure")
+	}
+	if !kBot.CastVote(ctx, userA, userB, "reaction-3", roomA, "message-2", 1, hour, "") {
+		t.Errorf("t1.3 failure")
+	}
+	kBot.KarmaDelete(ctx, "reaction-1", roomA)
+	if !kBot.CastVote(ctx, userA, userB, "reaction-4", roomA, "message-1", 1, hour, "") {
+		t.Errorf("t1.4 failure")
+	}
+	if kBot.GetKarma(ctx, userB, roomA, 0) != 2 {
+		t.Errorf("t1.5 failure: %d", kBot.GetKarma(ctx, userB, roomA, 0))
+	}
+
+	////// t2 at most N votes per target within the window
+	if err := kBot.SetRoomSetting(roomB, "max-votes-per-target", "2"); err != nil {
+		t.Fatal(err)
+	}
+	allowed := 0
+	for i := 0; i < 4; i++ {
+		if kBot.CastVote(ctx, userA, userB, fmt.Sprintf("thanks-%d", i), roomB, "", 1, hour+int64(i), "") {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("t2.1 failure: %d", allowed)
+	}
+	if !kBot.CastVote(ctx, userA, userB, "thanks-later", roomB, "", 1, 3*hour, "") {
+		t.Errorf("t2.2 failure")
+	}
+
+	////// t3 diminishing returns, only the 1st, 2nd, 4th and 8th count
+	if err := kBot.SetRoomSetting(roomA, "diminishing-votes", "on"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kBot.SetRoomSetting(roomA, "one-reaction-vote", "off"); err != nil {
+		t.Fatal(err)
+	}
+	kBot.KarmaDeleteRoom(ctx, roomA)
+	for i := 0; i < 8; i++ {
+		kBot.CastVote(ctx, userA, userB, fmt.Sprintf("thanks-%d", i), roomA, "", 1, hour+int64(i), "")
+	}
+	if kBot.GetKarma(ctx, userB, roomA, 0) != 4 {
+		t.Errorf("t3.1 failure: %d", kBot.GetKarma(ctx, userB, roomA, 0))
+	}
+	// reactions are not affected
+	kBot.CastVote(ctx, userA, userB, "reaction-5", roomA, "message-3", 1, hour+10, "")
+	kBot.CastVote(ctx, userA, userB, "reaction-6", roomA, "message-3", 1, hour+11, "")
+	if kBot.GetKarma(ctx, userB, roomA, 0) != 6 {
+		t.Errorf("t3.2 failure: %d", kBot.GetKarma(ctx, userB, roomA, 0))
+	}
+
+	////// t4 reactions and votes taking karma do not diminish later thanks
+	roomC := "third-cool-room-matrix.org"
+	if err := kBot.SetRoomSetting(roomC, "diminishing-votes", "on"); err != nil {
+		t.Fatal(err)
+	}
+	kBot.CastVote(ctx, userA, userB, "reaction-7", roomC, "message-4", 1, hour, "")
+	kBot.CastVote(ctx, userA, userB, "decrement-1", roomC, "", -1, hour+1, "")
+	kBot.CastVote(ctx, userA, userB, "thanks-a", roomC, "", 1, hour+2, "")
+	kBot.CastVote(ctx, userA, userB, "thanks-b", roomC, "", 1, hour+3, "")
+	kBot.CastVote(ctx, userA, userB, "thanks-c", roomC, "", 1, hour+4, "")
+	if kBot.GetKarma(ctx, userB, roomC, 0) != 2 {
+		t.Errorf("t4.1 failure: %d", kBot.GetKarma(ctx, userB, roomC, 0))
+	}
+	kBot.CastVote(ctx, userA, userB, "thanks-d", roomC, "", 1, hour+5, "")
+	if kBot.GetKarma(ctx, userB, roomC, 0) != 3 {
+		t.Errorf("t4.2 failure: %d", kBot.GetKarma(ctx, userB, roomC, 0))
+	}
+
+	////// t5 re-casting an early vote, as edits do, ignores the votes after it
+	roomD := "fourth-cool-room-matrix.org"
+	if err := kBot.SetRoomSetting(roomD, "diminishing-votes", "on"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		kBot.CastVote(ctx, userA, userB, fmt.Sprintf("$%d", i), roomD, "", 1, hour+int64(i), "")
+	}
+	kBot.KarmaDelete(ctx, "$1", roomD)
+	kBot.CastVote(ctx, userA, userB, "$1", roomD, "", 1, hour+1, "")
+	if kBot.GetKarma(ctx, userB, roomD, 0) != 2 {
+		t.Errorf("t5.1 failure: %d", kBot.GetKarma(ctx, userB, roomD, 0))
+	}
+	roomE := "fifth-cool-room-matrix.org"
+	if err := kBot.SetRoomSetting(roomE, "max-votes-per-target", "1"); err != nil {
+		t.Fatal(err)
+	}
+	kBot.CastVote(ctx, userA, userB, "$4", roomE, "", 1, hour, "")
+	kBot.CastVote(ctx, userA, userB, "$5", roomE, "", 1, hour+hour/2, "")
+	kBot.CastVote(ctx, userA, userB, "$6", roomE, "", 1, 3*hour, "")
+	kBot.KarmaDelete(ctx, "$4", roomE)
+	if !kBot.CastVote(ctx, userA, userB, "$4", roomE, "", 1, hour, "") || kBot.GetKarma(ctx, userB, roomE, 0) != 2 {
+		t.Errorf("t5.2 failure: %d", kBot.GetKarma(ctx, userB, roomE, 0))
+	}
+}
@@ -18,6 +18,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
@@ -79,15 +80,17 @@ func main() {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
+	// Start retries homeserver outages by itself and only returns on errors
+	// that need fixing, such as an invalid access token
 	go func() {
-		err := kbot.Start()
+		err := kbot.Start(context.Background())
 		if err != nil {
-			klog.Fatalf("Could not start the bot: %v", err)
+			klog.Fatalf("The bot stopped: %v", err)
 		}
 	}()
 
 	sig := <-done
 	klog.Infof("Caught signal '%v'", sig)
-	klog.Infof("Shutting down...")
+	klog.Infof("Shutting down, waiting up to %v for queued events and running handlers...", kConf.ShutdownTimeout)
 	kbot.Stop()
 }